@@ -0,0 +1,38 @@
+package catalog
+
+import "sort"
+
+// CategoryNode is a category with its children, for rendering the tree.
+type CategoryNode struct {
+	*Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// BuildTree arranges categories under their parents, sorted by name.
+// Categories whose parent is missing are returned as roots.
+func BuildTree(categories []*Category) []*CategoryNode {
+	nodes := make(map[string]*CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &CategoryNode{Category: category, Children: []*CategoryNode{}}
+	}
+
+	roots := []*CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if parent, ok := nodes[category.ParentID]; ok && category.ParentID != "" {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	var sortNodes func([]*CategoryNode)
+	sortNodes = func(list []*CategoryNode) {
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		for _, node := range list {
+			sortNodes(node.Children)
+		}
+	}
+	sortNodes(roots)
+	return roots
+}
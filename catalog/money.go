@@ -0,0 +1,149 @@
+package catalog
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"golang.org/x/text/currency"
+)
+
+// Amount is an exact decimal. It is stored in Mongo as Decimal128 and
+// written to JSON as a plain number so node-service payloads still decode.
+type Amount struct {
+	decimal.Decimal
+}
+
+// ParseAmount parses a decimal string such as "199.50".
+func ParseAmount(s string) (Amount, error) {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{d}, nil
+}
+
+func NewAmount(d decimal.Decimal) Amount {
+	return Amount{d}
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a number or a quoted decimal string. Numbers are
+// parsed from their literal text, so 0.1 stays exactly 0.1.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	d, err := decimal.NewFromString(string(bytes.Trim(b, `"`)))
+	if err != nil {
+		return fmt.Errorf("amount %s: %w", b, err)
+	}
+	a.Decimal = d
+	return nil
+}
+
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	d, err := primitive.ParseDecimal128(a.String())
+	if err != nil {
+		return 0, nil, err
+	}
+	return bson.MarshalValue(d)
+}
+
+// UnmarshalBSONValue reads Decimal128 and also the doubles, integers and
+// strings written before amounts were decimal.
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	v := bsoncore.Value{Type: t, Data: data}
+	switch t {
+	case bsontype.Decimal128:
+		d, err := decimal.NewFromString(v.Decimal128().String())
+		if err != nil {
+			return err
+		}
+		a.Decimal = d
+	case bsontype.Double:
+		a.Decimal = decimal.NewFromFloat(v.Double())
+	case bsontype.Int32:
+		a.Decimal = decimal.NewFromInt32(v.Int32())
+	case bsontype.Int64:
+		a.Decimal = decimal.NewFromInt(v.Int64())
+	case bsontype.String:
+		d, err := decimal.NewFromString(v.StringValue())
+		if err != nil {
+			return err
+		}
+		a.Decimal = d
+	case bsontype.Null, bsontype.Undefined:
+		a.Decimal = decimal.Zero
+	default:
+		return fmt.Errorf("cannot decode %s into an Amount", t)
+	}
+	return nil
+}
+
+// MinorUnits is the number of decimal places used by an ISO 4217 currency,
+// 2 for THB and USD and 0 for JPY. Unknown codes get 2.
+func MinorUnits(code string) int32 {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return 2
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	return int32(scale)
+}
+
+// Total is a price broken down into its net amount, the tax on it and the
+// gross amount the customer pays.
+type Total struct {
+	Currency string `json:"currency"`
+	Net      Amount `json:"net"`
+	Tax      Amount `json:"tax"`
+	Gross    Amount `json:"gross"`
+}
+
+// Calculate computes the price's totals. UnitOfMeasure.Amount is the net amount.
+// A percentage tax is rounded half away from zero to the currency's minor
+// units; a fixed tax is added as is. ok is false if the price has no amount.
+func (p *Price) Calculate() (total Total, ok bool) {
+	if p.UnitOfMeasure == nil {
+		return Total{}, false
+	}
+
+	code := p.UnitOfMeasure.Currency
+	net := p.UnitOfMeasure.Amount.Decimal
+	tax := decimal.Zero
+	if p.Tax != nil {
+		switch p.Tax.Type {
+		case TaxPercentage:
+			tax = net.Mul(p.Tax.Value.Decimal).Div(hundred).Round(MinorUnits(code))
+		case TaxFixed:
+			tax = p.Tax.Value.Decimal
+		}
+	}
+
+	return Total{
+		Currency: code,
+		Net:      Amount{net},
+		Tax:      Amount{tax},
+		Gross:    Amount{net.Add(tax)},
+	}, true
+}
+
+// ComputeTotals sets Total on every price that has an amount.
+func (p *Product) ComputeTotals() {
+	for _, price := range p.Price {
+		if price == nil {
+			continue
+		}
+		if total, ok := price.Calculate(); ok {
+			price.Total = &total
+		}
+	}
+}
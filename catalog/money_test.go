@@ -0,0 +1,139 @@
+package catalog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func amount(t *testing.T, s string) Amount {
+	t.Helper()
+	a, err := ParseAmount(s)
+	if err != nil {
+		t.Fatalf("ParseAmount(%q): %v", s, err)
+	}
+	return a
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		code string
+		want int32
+	}{
+		{"THB", 2},
+		{"USD", 2},
+		{"JPY", 0},
+		{"KWD", 3},
+		{"", 2},
+		{"XXXX", 2},
+	}
+	for _, tt := range tests {
+		if got := MinorUnits(tt.code); got != tt.want {
+			t.Errorf("MinorUnits(%q) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name            string
+		price           Price
+		ok              bool
+		net, tax, gross string
+	}{
+		{
+			name: "no amount",
+			ok:   false,
+		},
+		{
+			name:  "no tax",
+			price: Price{UnitOfMeasure: &UnitOfMeasure{Amount: amount(t, "199.50"), Currency: "THB"}},
+			ok:    true, net: "199.5", tax: "0", gross: "199.5",
+		},
+		{
+			name: "percentage rounds to satang",
+			price: Price{
+				UnitOfMeasure: &UnitOfMeasure{Amount: amount(t, "99.99"), Currency: "THB"},
+				Tax:           &Tax{Type: TaxPercentage, Value: amount(t, "7")},
+			},
+			ok: true, net: "99.99", tax: "7", gross: "106.99",
+		},
+		{
+			name: "percentage rounds half away from zero",
+			price: Price{
+				UnitOfMeasure: &UnitOfMeasure{Amount: amount(t, "0.50"), Currency: "THB"},
+				Tax:           &Tax{Type: TaxPercentage, Value: amount(t, "1")},
+			},
+			ok: true, net: "0.5", tax: "0.01", gross: "0.51",
+		},
+		{
+			name: "percentage rounds to whole yen",
+			price: Price{
+				UnitOfMeasure: &UnitOfMeasure{Amount: amount(t, "150"), Currency: "JPY"},
+				Tax:           &Tax{Type: TaxPercentage, Value: amount(t, "1")},
+			},
+			ok: true, net: "150", tax: "2", gross: "152",
+		},
+		{
+			name: "percentage keeps three places for dinar",
+			price: Price{
+				UnitOfMeasure: &UnitOfMeasure{Amount: amount(t, "1.235"), Currency: "KWD"},
+				Tax:           &Tax{Type: TaxPercentage, Value: amount(t, "10")},
+			},
+			ok: true, net: "1.235", tax: "0.124", gross: "1.359",
+		},
+		{
+			name: "fixed tax is added as is",
+			price: Price{
+				UnitOfMeasure: &UnitOfMeasure{Amount: amount(t, "10"), Currency: "JPY"},
+				Tax:           &Tax{Type: TaxFixed, Value: amount(t, "0.333")},
+			},
+			ok: true, net: "10", tax: "0.333", gross: "10.333",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, ok := tt.price.Calculate()
+			if ok != tt.ok {
+				t.Fatalf("Calculate() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got := total.Net.String(); got != tt.net {
+				t.Errorf("net = %s, want %s", got, tt.net)
+			}
+			if got := total.Tax.String(); got != tt.tax {
+				t.Errorf("tax = %s, want %s", got, tt.tax)
+			}
+			if got := total.Gross.String(); got != tt.gross {
+				t.Errorf("gross = %s, want %s", got, tt.gross)
+			}
+		})
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`0.1`, "0.1"},
+		{`"199.50"`, "199.5"},
+		{`12`, "12"},
+	}
+	for _, tt := range tests {
+		var a Amount
+		if err := json.Unmarshal([]byte(tt.in), &a); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tt.in, err)
+		}
+		if got := a.String(); got != tt.want {
+			t.Errorf("Unmarshal(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	var a Amount
+	if err := json.Unmarshal([]byte(`"abc"`), &a); err == nil {
+		t.Error(`Unmarshal("abc") succeeded, want an error`)
+	}
+}
@@ -0,0 +1,40 @@
+package catalog
+
+import "time"
+
+// EffectiveAt reports whether the price applies at t. Prices that are not
+// live never apply.
+func (p *Price) EffectiveAt(t time.Time) bool {
+	if !p.Status.Live() {
+		return false
+	}
+	if p.EffectiveFrom != nil && t.Before(*p.EffectiveFrom) {
+		return false
+	}
+	if p.EffectiveTo != nil && !t.Before(*p.EffectiveTo) {
+		return false
+	}
+	return true
+}
+
+// EffectivePrices returns the prices that apply at t, in their stored order.
+func (p *Product) EffectivePrices(t time.Time) []*Price {
+	prices := []*Price{}
+	for _, price := range p.Price {
+		if price != nil && price.EffectiveAt(t) {
+			prices = append(prices, price)
+		}
+	}
+	return prices
+}
+
+// overlaps reports whether the two windows share any instant.
+func (p *Price) overlaps(other *Price) bool {
+	if p.EffectiveTo != nil && other.EffectiveFrom != nil && !other.EffectiveFrom.Before(*p.EffectiveTo) {
+		return false
+	}
+	if other.EffectiveTo != nil && p.EffectiveFrom != nil && !p.EffectiveFrom.Before(*other.EffectiveTo) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+)
+
+func at(day int) *time.Time {
+	t := time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestEffectiveAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		price Price
+		at    time.Time
+		want  bool
+	}{
+		{"open window", Price{}, *at(10), true},
+		{"before from", Price{EffectiveFrom: at(10)}, *at(9), false},
+		{"from is inclusive", Price{EffectiveFrom: at(10)}, *at(10), true},
+		{"to is exclusive", Price{EffectiveTo: at(10)}, *at(10), false},
+		{"inside window", Price{EffectiveFrom: at(1), EffectiveTo: at(10)}, *at(5), true},
+		{"suspended", Price{Status: StatusSuspended}, *at(10), false},
+		{"draft", Price{Status: StatusDraft}, *at(10), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.price.EffectiveAt(tt.at); got != tt.want {
+				t.Errorf("EffectiveAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectivePrices(t *testing.T) {
+	regular := &Price{ID: "regular"}
+	promotion := &Price{ID: "promotion", EffectiveFrom: at(10), EffectiveTo: at(20)}
+	product := Product{Price: []*Price{nil, regular, promotion}}
+
+	if got := product.EffectivePrices(*at(5)); len(got) != 1 || got[0] != regular {
+		t.Errorf("EffectivePrices(5th) = %v, want [regular]", got)
+	}
+	if got := product.EffectivePrices(*at(15)); len(got) != 2 || got[1] != promotion {
+		t.Errorf("EffectivePrices(15th) = %v, want [regular promotion]", got)
+	}
+	if got := (&Product{}).EffectivePrices(*at(5)); got == nil || len(got) != 0 {
+		t.Errorf("EffectivePrices() on no prices = %#v, want an empty slice", got)
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Price
+		want bool
+	}{
+		{"both open", Price{}, Price{}, true},
+		{"disjoint", Price{EffectiveTo: at(10)}, Price{EffectiveFrom: at(11)}, false},
+		{"adjacent", Price{EffectiveTo: at(10)}, Price{EffectiveFrom: at(10)}, false},
+		{"adjacent reversed", Price{EffectiveFrom: at(10)}, Price{EffectiveTo: at(10)}, false},
+		{"one day shared", Price{EffectiveTo: at(11)}, Price{EffectiveFrom: at(10)}, true},
+		{"nested", Price{EffectiveFrom: at(1), EffectiveTo: at(30)}, Price{EffectiveFrom: at(10), EffectiveTo: at(20)}, true},
+		{"open end overlaps later window", Price{EffectiveFrom: at(1)}, Price{EffectiveFrom: at(10), EffectiveTo: at(20)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.overlaps(&tt.b); got != tt.want {
+				t.Errorf("overlaps() = %v, want %v", got, tt.want)
+			}
+			if got := tt.b.overlaps(&tt.a); got != tt.want {
+				t.Errorf("overlaps() reversed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
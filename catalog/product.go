@@ -0,0 +1,106 @@
+// Package catalog is the product model shared by node-products and
+// service_consumer. JSON keys follow the events node-service publishes,
+// including the capitalised SupportingLanguage key; BSON keys match them.
+// Documents written before this package used lowercased keys and string
+// timestamps; store.MigrateLegacy rewrites them.
+package catalog
+
+import "time"
+
+type Product struct {
+	ID                 string                `json:"id,omitempty" bson:"id"`
+	Name               string                `json:"name,omitempty" bson:"name,omitempty"`
+	Href               string                `json:"href,omitempty" bson:"-"`
+	Price              []*Price              `json:"price,omitempty" bson:"price,omitempty"`
+	Category           []*Category           `json:"category,omitempty" bson:"category,omitempty"`
+	Description        string                `json:"description,omitempty" bson:"description,omitempty"`
+	Stock              int                   `json:"stock,omitempty" bson:"stock"`
+	Status             Status                `json:"status,omitempty" bson:"status,omitempty"`
+	CreatedAt          time.Time             `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt          time.Time             `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	DeleteDate         *time.Time            `json:"deleteDate,omitempty" bson:"deleteDate,omitempty"`
+	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty" bson:"SupportingLanguage,omitempty"`
+	StatusHistory      []StatusChange        `json:"statusHistory,omitempty" bson:"statusHistory,omitempty"`
+}
+
+// Price is effective from EffectiveFrom (inclusive) until EffectiveTo
+// (exclusive). A nil bound leaves that side of the window open. Type groups
+// prices that replace each other, such as "regular" and "promotion"; two
+// prices of the same type must not be effective at the same time.
+type Price struct {
+	ID                 string                `json:"id,omitempty" bson:"id,omitempty"`
+	Name               string                `json:"name,omitempty" bson:"name,omitempty"`
+	Type               string                `json:"type,omitempty" bson:"type,omitempty"`
+	EffectiveFrom      *time.Time            `json:"effectiveFrom,omitempty" bson:"effectiveFrom,omitempty"`
+	EffectiveTo        *time.Time            `json:"effectiveTo,omitempty" bson:"effectiveTo,omitempty"`
+	Tax                *Tax                  `json:"tax,omitempty" bson:"tax,omitempty"`
+	PopRelationships   []*PopRelationship    `json:"popRelationship,omitempty" bson:"popRelationship,omitempty"`
+	UnitOfMeasure      *UnitOfMeasure        `json:"unitOfMeasure,omitempty" bson:"unitOfMeasure,omitempty"`
+	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty" bson:"SupportingLanguage,omitempty"`
+	Status             Status                `json:"status,omitempty" bson:"status,omitempty"`
+	CreatedAt          time.Time             `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt          time.Time             `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	Total              *Total                `json:"total,omitempty" bson:"-"`
+}
+
+type Tax struct {
+	Type  TaxType `json:"type,omitempty" bson:"type,omitempty"`
+	Value Amount  `json:"value" bson:"value"`
+}
+
+type PopRelationship struct {
+	ID   string `json:"id,omitempty" bson:"id,omitempty"`
+	Name string `json:"name,omitempty" bson:"name,omitempty"`
+}
+
+type UnitOfMeasure struct {
+	Unit     string `json:"unit,omitempty" bson:"unit,omitempty"`
+	Amount   Amount `json:"amount" bson:"amount"`
+	Currency string `json:"currency,omitempty" bson:"currency,omitempty"`
+}
+
+// Category is stored in the categories collection and embedded as a
+// snapshot in Product.Category. ParentID links it into a tree; Ancestors
+// lists every category above it, root first, so a subtree is one query.
+type Category struct {
+	ID                 string                `json:"id,omitempty" bson:"id,omitempty"`
+	Name               string                `json:"name,omitempty" bson:"name,omitempty"`
+	ParentID           string                `json:"parentId,omitempty" bson:"parentId,omitempty"`
+	Ancestors          []string              `json:"ancestors,omitempty" bson:"ancestors,omitempty"`
+	Description        string                `json:"description,omitempty" bson:"description,omitempty"`
+	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty" bson:"SupportingLanguage,omitempty"`
+	Status             Status                `json:"status,omitempty" bson:"status,omitempty"`
+	CreatedAt          time.Time             `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt          time.Time             `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// SupportingLanguage is stored in full in product_languages. Products embed
+// only the id, name and languageCode.
+type SupportingLanguage struct {
+	ID            string         `json:"id,omitempty" bson:"id,omitempty"`
+	Name          string         `json:"name,omitempty" bson:"name,omitempty"`
+	Description   string         `json:"description,omitempty" bson:"description,omitempty"`
+	LanguageCode  string         `json:"languageCode,omitempty" bson:"languageCode,omitempty"`
+	UnitOfMeasure *UnitOfMeasure `json:"unitOfMeasure,omitempty" bson:"unitOfMeasure,omitempty"`
+	Attachment    []*Attachment  `json:"attachment,omitempty" bson:"attachment,omitempty"`
+	Status        Status         `json:"status,omitempty" bson:"status,omitempty"`
+	CreatedAt     time.Time      `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt     time.Time      `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+type Attachment struct {
+	ID          string    `json:"id,omitempty" bson:"id,omitempty"`
+	Name        string    `json:"name,omitempty" bson:"name,omitempty"`
+	URL         string    `json:"url,omitempty" bson:"url,omitempty"`
+	Type        string    `json:"type,omitempty" bson:"type,omitempty"`
+	Status      Status    `json:"status,omitempty" bson:"status,omitempty"`
+	CreatedAt   time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	Display     *Display  `json:"display,omitempty" bson:"display,omitempty"`
+	RedirectURL string    `json:"redirectUrl,omitempty" bson:"redirectUrl,omitempty"`
+}
+
+type Display struct {
+	Type  DisplayType `json:"type,omitempty" bson:"type,omitempty"`
+	Value string      `json:"value,omitempty" bson:"value,omitempty"`
+}
@@ -0,0 +1,128 @@
+package catalog
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status is the lifecycle state shared by products, prices, categories,
+// languages and attachments:
+//
+//	draft → active ⇄ suspended
+//	  ↘       ↓       ↓
+//	        retired
+//
+// Retired is final. An empty status predates the lifecycle and is treated
+// as active.
+type Status string
+
+const (
+	StatusDraft     Status = "draft"
+	StatusActive    Status = "active"
+	StatusSuspended Status = "suspended"
+	StatusRetired   Status = "retired"
+)
+
+// statusInactive is what documents written before the lifecycle used for
+// suspended. Events that still send it decode as suspended, and
+// store.MigrateLegacy rewrites stored documents.
+const statusInactive Status = "inactive"
+
+var transitions = map[Status][]Status{
+	StatusDraft:     {StatusActive, StatusRetired},
+	StatusActive:    {StatusSuspended, StatusRetired},
+	StatusSuspended: {StatusActive, StatusRetired},
+}
+
+func (s Status) Valid() bool {
+	switch s {
+	case StatusDraft, StatusActive, StatusSuspended, StatusRetired:
+		return true
+	}
+	return false
+}
+
+// UnmarshalText reads the legacy "inactive" as suspended.
+func (s *Status) UnmarshalText(text []byte) error {
+	*s = Status(text)
+	if *s == statusInactive {
+		*s = StatusSuspended
+	}
+	return nil
+}
+
+// Live reports whether something in this state is shown to customers.
+func (s Status) Live() bool {
+	return s == "" || s == StatusActive
+}
+
+// CanTransition reports whether the lifecycle allows moving from s to to.
+func (s Status) CanTransition(to Status) bool {
+	switch s {
+	case "":
+		s = StatusActive
+	case statusInactive:
+		s = StatusSuspended
+	}
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError is returned for a move the lifecycle does not allow.
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change status from %q to %q", e.From, e.To)
+}
+
+// StatusChange records one transition in Product.StatusHistory. Source is
+// what triggered it, such as "http" or "kafka:status.products".
+type StatusChange struct {
+	From   Status    `json:"from" bson:"from"`
+	To     Status    `json:"to" bson:"to"`
+	Reason string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	Source string    `json:"source,omitempty" bson:"source,omitempty"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// TaxType says how Tax.Value is applied to a price.
+type TaxType string
+
+const (
+	// TaxPercentage adds Value percent of the net amount.
+	TaxPercentage TaxType = "percentage"
+	// TaxFixed adds Value in the price's currency.
+	TaxFixed TaxType = "fixed"
+)
+
+func (t TaxType) Valid() bool {
+	switch t {
+	case TaxPercentage, TaxFixed:
+		return true
+	}
+	return false
+}
+
+// DisplayType says how Display.Value should be rendered.
+type DisplayType string
+
+const (
+	DisplayText  DisplayType = "text"
+	DisplayHTML  DisplayType = "html"
+	DisplayColor DisplayType = "color"
+)
+
+func (t DisplayType) Valid() bool {
+	switch t {
+	case DisplayText, DisplayHTML, DisplayColor:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package catalog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusDraft, StatusActive, true},
+		{StatusDraft, StatusRetired, true},
+		{StatusDraft, StatusSuspended, false},
+		{StatusActive, StatusSuspended, true},
+		{StatusActive, StatusRetired, true},
+		{StatusActive, StatusDraft, false},
+		{StatusActive, StatusActive, false},
+		{StatusSuspended, StatusActive, true},
+		{StatusSuspended, StatusRetired, true},
+		{StatusSuspended, StatusDraft, false},
+		{StatusRetired, StatusActive, false},
+		{StatusRetired, StatusDraft, false},
+		{"", StatusSuspended, true},
+		{"", StatusDraft, false},
+		{"inactive", StatusActive, true},
+		{"inactive", StatusRetired, true},
+		{"bogus", StatusActive, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%q.CanTransition(%q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestStatusLive(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   bool
+	}{
+		{"", true},
+		{StatusActive, true},
+		{StatusDraft, false},
+		{StatusSuspended, false},
+		{StatusRetired, false},
+	}
+	for _, tt := range tests {
+		if got := tt.status.Live(); got != tt.want {
+			t.Errorf("%q.Live() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestStatusUnmarshalInactive(t *testing.T) {
+	var price Price
+	if err := json.Unmarshal([]byte(`{"status":"inactive"}`), &price); err != nil {
+		t.Fatal(err)
+	}
+	if price.Status != StatusSuspended {
+		t.Errorf("status = %q, want %q", price.Status, StatusSuspended)
+	}
+}
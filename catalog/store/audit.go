@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Source says what triggered a mutation: a consumed message, an HTTP
+// request or a background job.
+type Source struct {
+	Kind      string `json:"kind" bson:"kind"`
+	Topic     string `json:"topic,omitempty" bson:"topic,omitempty"`
+	Partition int32  `json:"partition,omitempty" bson:"partition,omitempty"`
+	Offset    int64  `json:"offset,omitempty" bson:"offset,omitempty"`
+	Method    string `json:"method,omitempty" bson:"method,omitempty"`
+	Path      string `json:"path,omitempty" bson:"path,omitempty"`
+	User      string `json:"user,omitempty" bson:"user,omitempty"`
+	Job       string `json:"job,omitempty" bson:"job,omitempty"`
+
+	// CorrelationID is stored on the audit entry itself.
+	CorrelationID string `json:"-" bson:"-"`
+}
+
+type sourceKey struct{}
+
+// WithSource returns a context whose mutations are audited as coming from
+// src.
+func WithSource(ctx context.Context, src Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+func sourceFrom(ctx context.Context) Source {
+	if src, ok := ctx.Value(sourceKey{}).(Source); ok {
+		return src
+	}
+	return Source{Kind: "unknown"}
+}
+
+// Change is one value that differs, addressed by its JSON path such as
+// price[0].unitOfMeasure.amount.
+type Change struct {
+	Path   string `json:"path" bson:"path"`
+	Before any    `json:"before,omitempty" bson:"before,omitempty"`
+	After  any    `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+type AuditEntry struct {
+	ID            string    `json:"id" bson:"id"`
+	ProductID     string    `json:"productId" bson:"productId"`
+	Action        string    `json:"action" bson:"action"`
+	Changes       []Change  `json:"changes" bson:"changes"`
+	Source        Source    `json:"source" bson:"source"`
+	CorrelationID string    `json:"correlationId,omitempty" bson:"correlationId,omitempty"`
+	Timestamp     time.Time `json:"timestamp" bson:"timestamp"`
+}
+
+// Audit appends to the product_audit collection.
+type Audit struct {
+	entries *mongo.Collection
+
+	// OnError is called when an entry cannot be written. The mutation it
+	// describes has already been stored, so callers log rather than fail.
+	OnError func(ctx context.Context, err error)
+}
+
+// NewAudit decodes nested values as maps rather than bson.D so history
+// renders as plain JSON objects.
+func NewAudit(db *mongo.Database) *Audit {
+	return &Audit{entries: db.Collection("product_audit",
+		options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true}))}
+}
+
+func (a *Audit) EnsureIndexes(ctx context.Context) error {
+	_, err := a.entries.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "productId", Value: 1}, {Key: "timestamp", Value: -1}},
+	})
+	return err
+}
+
+// Record diffs before and after, either of which may be nil, and appends
+// the result with the source found in ctx.
+func (a *Audit) Record(ctx context.Context, action, productID string, before, after any) {
+	changes, err := Diff(before, after)
+	if err == nil {
+		err = a.Append(ctx, action, productID, changes)
+	}
+	if err != nil && a.OnError != nil {
+		a.OnError(ctx, fmt.Errorf("audit %s %s: %w", action, productID, err))
+	}
+}
+
+// Append stores an entry with changes the caller already worked out.
+func (a *Audit) Append(ctx context.Context, action, productID string, changes []Change) error {
+	src := sourceFrom(ctx)
+	_, err := a.entries.InsertOne(ctx, AuditEntry{
+		ID:            primitive.NewObjectID().Hex(),
+		ProductID:     productID,
+		Action:        action,
+		Changes:       changes,
+		Source:        src,
+		CorrelationID: src.CorrelationID,
+		Timestamp:     time.Now().UTC(),
+	})
+	return err
+}
+
+// History returns up to limit entries for a product, newest first.
+func (a *Audit) History(ctx context.Context, productID string, limit int64) ([]AuditEntry, error) {
+	cursor, err := a.entries.Find(ctx, bson.M{"productId": productID},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	entries := []AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Diff compares the JSON forms of before and after and returns every leaf
+// that differs.
+func Diff(before, after any) ([]Change, error) {
+	b, err := toJSONValue(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := toJSONValue(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := []Change{}
+	diff("", b, a, &changes)
+	return changes, nil
+}
+
+func toJSONValue(v any) (any, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return map[string]any{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+func diff(path string, before, after any, changes *[]Change) {
+	switch b := before.(type) {
+	case map[string]any:
+		if a, ok := after.(map[string]any); ok {
+			keys := map[string]bool{}
+			for k := range b {
+				keys[k] = true
+			}
+			for k := range a {
+				keys[k] = true
+			}
+			sorted := make([]string, 0, len(keys))
+			for k := range keys {
+				sorted = append(sorted, k)
+			}
+			sort.Strings(sorted)
+			for _, k := range sorted {
+				child := k
+				if path != "" {
+					child = path + "." + k
+				}
+				diff(child, b[k], a[k], changes)
+			}
+			return
+		}
+	case []any:
+		if a, ok := after.([]any); ok {
+			for i := 0; i < len(b) || i < len(a); i++ {
+				var bi, ai any
+				if i < len(b) {
+					bi = b[i]
+				}
+				if i < len(a) {
+					ai = a[i]
+				}
+				diff(fmt.Sprintf("%s[%d]", path, i), bi, ai, changes)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, Change{Path: path, Before: before, After: after})
+	}
+}
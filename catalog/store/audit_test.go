@@ -0,0 +1,62 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sing3demons/catalog"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after any
+		want          []Change
+	}{
+		{
+			name:   "unchanged",
+			before: &catalog.Product{ID: "p1", Stock: 3},
+			after:  &catalog.Product{ID: "p1", Stock: 3},
+			want:   []Change{},
+		},
+		{
+			name:   "changed leaves are sorted by path",
+			before: &catalog.Product{ID: "p1", Name: "Tea", Stock: 3},
+			after:  &catalog.Product{ID: "p1", Name: "Coffee", Stock: 1},
+			want: []Change{
+				{Path: "name", Before: "Tea", After: "Coffee"},
+				{Path: "stock", Before: float64(3), After: float64(1)},
+			},
+		},
+		{
+			name:   "nested array element",
+			before: &catalog.Product{Price: []*catalog.Price{{ID: "a", Status: catalog.StatusActive}}},
+			after:  &catalog.Product{Price: []*catalog.Price{{ID: "a", Status: catalog.StatusSuspended}}},
+			want:   []Change{{Path: "price[0].status", Before: "active", After: "suspended"}},
+		},
+		{
+			name:   "appended element",
+			before: map[string]any{"tags": []string{"a"}},
+			after:  map[string]any{"tags": []string{"a", "b"}},
+			want:   []Change{{Path: "tags[1]", Before: nil, After: "b"}},
+		},
+		{
+			name:   "created from nil",
+			before: (*catalog.Category)(nil),
+			after:  map[string]any{"id": "c1"},
+			want:   []Change{{Path: "id", Before: nil, After: "c1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.before, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
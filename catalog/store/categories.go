@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sing3demons/catalog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrParentNotFound   = errors.New("parent category not found")
+)
+
+// Categories writes the categories collection and keeps the snapshots
+// embedded in products in step with it.
+type Categories struct {
+	categories *mongo.Collection
+	products   *mongo.Collection
+	audit      *Audit
+}
+
+func NewCategories(db *mongo.Database, audit *Audit) *Categories {
+	return &Categories{
+		categories: db.Collection("categories"),
+		products:   db.Collection("products"),
+		audit:      audit,
+	}
+}
+
+func (s *Categories) EnsureIndexes(ctx context.Context) error {
+	_, err := s.categories.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "ancestors", Value: 1}}},
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+	})
+	return err
+}
+
+// Create inserts a category, deriving Ancestors from its parent.
+func (s *Categories) Create(ctx context.Context, category *catalog.Category) error {
+	category.Ancestors = nil
+	if category.ParentID != "" {
+		parent, err := s.Get(ctx, category.ParentID)
+		if errors.Is(err, ErrCategoryNotFound) {
+			return ErrParentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		category.Ancestors = append(append([]string{}, parent.Ancestors...), parent.ID)
+	}
+	_, err := s.categories.InsertOne(ctx, category)
+	return err
+}
+
+func (s *Categories) Get(ctx context.Context, id string) (*catalog.Category, error) {
+	var category catalog.Category
+	err := s.categories.FindOne(ctx, bson.M{"id": id}).Decode(&category)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (s *Categories) All(ctx context.Context) ([]*catalog.Category, error) {
+	cursor, err := s.categories.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	categories := []*catalog.Category{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// Subtree returns the id of the category and of every category below it.
+func (s *Categories) Subtree(ctx context.Context, id string) ([]string, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	cursor, err := s.categories.Find(ctx, bson.M{"ancestors": id}, options.Find().SetProjection(bson.M{"id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var descendants []catalog.Category
+	if err := cursor.All(ctx, &descendants); err != nil {
+		return nil, err
+	}
+	ids := []string{id}
+	for _, d := range descendants {
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
+}
+
+// Link replaces each embedded category that matches a stored one, by id or
+// else by exact name, with a snapshot of the stored category, so a later
+// Rename reaches the product. Unmatched entries are left as they are.
+func (s *Categories) Link(ctx context.Context, embedded []*catalog.Category) error {
+	ids, names := bson.A{}, bson.A{}
+	for _, category := range embedded {
+		if category == nil {
+			continue
+		}
+		if category.ID != "" {
+			ids = append(ids, category.ID)
+		} else if category.Name != "" {
+			names = append(names, category.Name)
+		}
+	}
+	if len(ids) == 0 && len(names) == 0 {
+		return nil
+	}
+
+	cursor, err := s.categories.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"id": bson.M{"$in": ids}},
+		bson.M{"name": bson.M{"$in": names}},
+	}}, options.Find().SetProjection(bson.M{"_id": 0}))
+	if err != nil {
+		return err
+	}
+	var stored []*catalog.Category
+	if err := cursor.All(ctx, &stored); err != nil {
+		return err
+	}
+	byID, byName := map[string]*catalog.Category{}, map[string]*catalog.Category{}
+	for _, category := range stored {
+		byID[category.ID] = category
+		byName[category.Name] = category
+	}
+
+	for i, category := range embedded {
+		if category == nil {
+			continue
+		}
+		match, ok := byID[category.ID]
+		if category.ID == "" {
+			match, ok = byName[category.Name]
+		}
+		if ok {
+			snapshot := *match
+			embedded[i] = &snapshot
+		}
+	}
+	return nil
+}
+
+// Rename changes a category's name and description and rewrites the
+// matching entry of every product's embedded Category list. It returns the
+// updated category and the ids of the products changed.
+func (s *Categories) Rename(ctx context.Context, id, name, description string) (*catalog.Category, []string, error) {
+	now := time.Now().UTC()
+	var before catalog.Category
+	err := s.categories.FindOneAndUpdate(ctx, bson.M{"id": id}, bson.M{
+		"$set": bson.M{"name": name, "description": description, "updatedAt": now},
+	}).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	after := before
+	after.Name, after.Description, after.UpdatedAt = name, description, now
+
+	changes := []Change{{Path: "category.name", Before: before.Name, After: name}}
+	if before.Description != description {
+		changes = append(changes, Change{Path: "category.description", Before: before.Description, After: description})
+	}
+	ids, err := s.propagate(ctx, id, "category.renamed", bson.M{
+		"category.$[c].name":        name,
+		"category.$[c].description": description,
+		"category.$[c].updatedAt":   now,
+	}, changes)
+	return &after, ids, err
+}
+
+// Transition moves a category to change.To if the lifecycle allows it and
+// updates the snapshot embedded in every product that lists it. It returns
+// the updated category and the ids of the products changed.
+func (s *Categories) Transition(ctx context.Context, id string, change catalog.StatusChange) (*catalog.Category, []string, error) {
+	current, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkTransition(&change, current.Status); err != nil {
+		return nil, nil, err
+	}
+
+	var updated catalog.Category
+	err = s.categories.FindOneAndUpdate(ctx, bson.M{"id": id, "status": statusFilter(current.Status)}, bson.M{
+		"$set": bson.M{"status": change.To, "updatedAt": change.At},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrConflict
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids, err := s.propagate(ctx, id, "category.status", bson.M{
+		"category.$[c].status":    change.To,
+		"category.$[c].updatedAt": change.At,
+	}, []Change{{Path: "category.status", Before: change.From, After: change.To}})
+	return &updated, ids, err
+}
+
+// propagate applies set to the category's entry in every product that lists
+// it and audits each product with changes. It returns the product ids.
+func (s *Categories) propagate(ctx context.Context, id, action string, set bson.M, changes []Change) ([]string, error) {
+	// Collect the ids first so each product gets its own audit entry.
+	cursor, err := s.products.Find(ctx, bson.M{"category.id": id}, options.Find().SetProjection(bson.M{"id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var affected []catalog.Product
+	if err := cursor.All(ctx, &affected); err != nil {
+		return nil, err
+	}
+	if len(affected) == 0 {
+		return nil, nil
+	}
+
+	_, err = s.products.UpdateMany(ctx, bson.M{"category.id": id}, bson.M{"$set": set},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []any{bson.M{"c.id": id}},
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(affected))
+	for _, product := range affected {
+		ids = append(ids, product.ID)
+		if err := s.audit.Append(ctx, action, product.ID, changes); err != nil && s.audit.OnError != nil {
+			s.audit.OnError(ctx, err)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sing3demons/catalog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Delete soft-deletes a product by setting deleteDate. The product stays
+// restorable until Purge removes it. Deleting a product that is missing or
+// already deleted returns ErrNotFound.
+func (s *Products) Delete(ctx context.Context, id string) (*catalog.Product, error) {
+	now := time.Now().UTC()
+	var before catalog.Product
+	err := s.products.FindOneAndUpdate(ctx, bson.M{
+		"id":         id,
+		"deleteDate": primitive.Null{},
+	}, bson.M{
+		"$set": bson.M{"deleteDate": now, "updatedAt": now},
+	}).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	after := before
+	after.DeleteDate = &now
+	after.UpdatedAt = now
+	s.Audit.Record(ctx, "delete", id, &before, &after)
+	return &after, nil
+}
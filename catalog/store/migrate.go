@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/catalog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// legacyKeys maps the keys written by the untagged structs service_consumer
+// used before the catalog module, which the driver lowercased, to the keys
+// the catalog tags use.
+var legacyKeys = map[string]string{
+	"supportinglanguage": "SupportingLanguage",
+	"createdat":          "createdAt",
+	"updatedat":          "updatedAt",
+	"poprelationships":   "popRelationship",
+	"unitofmeasure":      "unitOfMeasure",
+	"languagecode":       "languageCode",
+	"redirecturl":        "redirectUrl",
+}
+
+// legacyFilter matches documents that still carry a lowercased key, a
+// timestamp stored as the string node-service sent, or the "inactive"
+// status the lifecycle replaced with suspended.
+var legacyFilter = bson.M{"$or": bson.A{
+	bson.M{"supportinglanguage": bson.M{"$exists": true}},
+	bson.M{"createdat": bson.M{"$exists": true}},
+	bson.M{"updatedat": bson.M{"$exists": true}},
+	bson.M{"languagecode": bson.M{"$exists": true}},
+	bson.M{"createdAt": bson.M{"$type": "string"}},
+	bson.M{"status": "inactive"},
+	bson.M{"price.status": "inactive"},
+	bson.M{"price.SupportingLanguage.status": "inactive"},
+	bson.M{"category.status": "inactive"},
+	bson.M{"SupportingLanguage.status": "inactive"},
+	bson.M{"attachment.status": "inactive"},
+}}
+
+// MigrateLegacy rewrites products and product languages stored before the
+// catalog module to its keys and types. Documents already migrated are not
+// matched, so it is safe to run on every start. It returns the number of
+// documents rewritten.
+func MigrateLegacy(ctx context.Context, db *mongo.Database) (int, error) {
+	migrated := 0
+	for _, name := range []string{"products", "product_languages"} {
+		n, err := migrateCollection(ctx, db.Collection(name))
+		migrated += n
+		if err != nil {
+			return migrated, err
+		}
+	}
+	return migrated, nil
+}
+
+func migrateCollection(ctx context.Context, collection *mongo.Collection) (int, error) {
+	cursor, err := collection.Find(ctx, legacyFilter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return migrated, err
+		}
+		id := doc["_id"]
+		if _, err := collection.ReplaceOne(ctx, bson.M{"_id": id}, migrateValue(doc)); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
+}
+
+// migrateValue renames legacy keys at every level, parses string timestamps
+// and maps an "inactive" status to suspended. A timestamp that does not
+// parse is dropped rather than left in a shape the catalog types cannot
+// decode.
+func migrateValue(v any) any {
+	switch v := v.(type) {
+	case bson.M:
+		doc := bson.M{}
+		for key, value := range v {
+			if renamed, ok := legacyKeys[key]; ok {
+				key = renamed
+			}
+			value = migrateValue(value)
+			if key == "status" && value == "inactive" {
+				value = string(catalog.StatusSuspended)
+			}
+			if key == "createdAt" || key == "updatedAt" {
+				if s, ok := value.(string); ok {
+					t, err := time.Parse(time.RFC3339Nano, s)
+					if err != nil {
+						continue
+					}
+					value = t.UTC()
+				}
+			}
+			doc[key] = value
+		}
+		return doc
+	case bson.D:
+		doc := bson.M{}
+		for _, e := range v {
+			doc[e.Key] = e.Value
+		}
+		return migrateValue(doc)
+	case bson.A:
+		values := make(bson.A, len(v))
+		for i, value := range v {
+			values[i] = migrateValue(value)
+		}
+		return values
+	default:
+		return v
+	}
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMigrateValue(t *testing.T) {
+	created := time.Date(2024, 2, 11, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		in   bson.M
+		want bson.M
+	}{
+		{
+			name: "renames nested keys",
+			in: bson.M{
+				"id": "p1",
+				"price": bson.A{bson.M{
+					"unitofmeasure":    bson.M{"amount": 10.5},
+					"poprelationships": bson.A{bson.M{"id": "x"}},
+				}},
+				"supportinglanguage": bson.A{bson.D{{Key: "languagecode", Value: "th"}}},
+			},
+			want: bson.M{
+				"id": "p1",
+				"price": bson.A{bson.M{
+					"unitOfMeasure":   bson.M{"amount": 10.5},
+					"popRelationship": bson.A{bson.M{"id": "x"}},
+				}},
+				"SupportingLanguage": bson.A{bson.M{"languageCode": "th"}},
+			},
+		},
+		{
+			name: "parses string timestamps",
+			in:   bson.M{"createdat": "2024-02-11T10:00:00.000Z", "updatedAt": "2024-02-11T17:00:00+07:00"},
+			want: bson.M{"createdAt": created, "updatedAt": created},
+		},
+		{
+			name: "drops unparsable timestamps",
+			in:   bson.M{"id": "p1", "createdat": "yesterday"},
+			want: bson.M{"id": "p1"},
+		},
+		{
+			name: "maps inactive to suspended at every level",
+			in: bson.M{
+				"status": "inactive",
+				"price":  bson.A{bson.M{"status": "inactive"}, bson.M{"status": "active"}},
+			},
+			want: bson.M{
+				"status": "suspended",
+				"price":  bson.A{bson.M{"status": "suspended"}, bson.M{"status": "active"}},
+			},
+		},
+		{
+			name: "leaves migrated documents alone",
+			in:   bson.M{"createdAt": created, "SupportingLanguage": bson.A{}},
+			want: bson.M{"createdAt": created, "SupportingLanguage": bson.A{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := migrateValue(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("migrateValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
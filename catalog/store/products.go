@@ -0,0 +1,136 @@
+// Package store holds the product writes shared by node-products and
+// service_consumer, so a change made over HTTP and the same change arriving
+// as an event follow the same rules.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sing3demons/catalog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotFound = errors.New("product not found")
+	// ErrConflict means the product changed between read and write.
+	ErrConflict = errors.New("product was modified concurrently")
+	// ErrExists is returned by Create for a product id that is already
+	// stored, such as a redelivered create event.
+	ErrExists = errors.New("product already exists")
+	// ErrLanguageExists is the CreateLanguage counterpart of ErrExists.
+	ErrLanguageExists = errors.New("language already exists")
+)
+
+// Products writes product documents and records each change in Audit.
+type Products struct {
+	products  *mongo.Collection
+	languages *mongo.Collection
+	Audit     *Audit
+}
+
+func NewProducts(db *mongo.Database) *Products {
+	return &Products{
+		products:  db.Collection("products"),
+		languages: db.Collection("product_languages"),
+		Audit:     NewAudit(db),
+	}
+}
+
+// EnsureIndexes makes product and language ids unique, which is what lets
+// Create and CreateLanguage detect a redelivered event. It fails while duplicates are stored.
+func (s *Products) EnsureIndexes(ctx context.Context) error {
+	unique := mongo.IndexModel{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)}
+	if _, err := s.products.Indexes().CreateOne(ctx, unique); err != nil {
+		return err
+	}
+	_, err := s.languages.Indexes().CreateOne(ctx, unique)
+	return err
+}
+
+// Create inserts a new product. It returns ErrExists if the id is taken.
+func (s *Products) Create(ctx context.Context, product *catalog.Product) error {
+	_, err := s.products.InsertOne(ctx, product)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	if err != nil {
+		return err
+	}
+	s.Audit.Record(ctx, "create", product.ID, nil, product)
+	return nil
+}
+
+// CreateLanguage inserts a language document into product_languages. As
+// with TransitionLanguage, the audit entry is keyed by the language id. It
+// returns ErrLanguageExists if the id is taken.
+func (s *Products) CreateLanguage(ctx context.Context, language *catalog.SupportingLanguage) error {
+	_, err := s.languages.InsertOne(ctx, language)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLanguageExists
+	}
+	if err != nil {
+		return err
+	}
+	s.Audit.Record(ctx, "language.create", language.ID, nil, language)
+	return nil
+}
+
+// Transition moves a product to change.To if the lifecycle allows it and
+// appends change to its status history. The update only matches while the
+// product still has the status that was checked.
+func (s *Products) Transition(ctx context.Context, id string, change catalog.StatusChange) (*catalog.Product, error) {
+	var current catalog.Product
+	err := s.products.FindOne(ctx, bson.M{"id": id, "deleteDate": primitive.Null{}}).Decode(&current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTransition(&change, current.Status); err != nil {
+		return nil, err
+	}
+	filter := bson.M{"id": id, "deleteDate": primitive.Null{}, "status": statusFilter(current.Status)}
+
+	var updated catalog.Product
+	err = s.products.FindOneAndUpdate(ctx, filter, bson.M{
+		"$set":  bson.M{"status": change.To, "updatedAt": change.At},
+		"$push": bson.M{"statusHistory": change},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Audit.Record(ctx, "status", id, &current, &updated)
+	return &updated, nil
+}
+
+// checkTransition sets change.From, and change.At if it is unset, and
+// rejects a move the lifecycle does not allow.
+func checkTransition(change *catalog.StatusChange, from catalog.Status) error {
+	change.From = from
+	if !change.From.CanTransition(change.To) {
+		return &catalog.TransitionError{From: change.From, To: change.To}
+	}
+	if change.At.IsZero() {
+		change.At = time.Now().UTC()
+	}
+	return nil
+}
+
+// statusFilter matches a stored status, treating a missing status like an
+// empty one.
+func statusFilter(status catalog.Status) any {
+	if status == "" {
+		return bson.M{"$in": bson.A{"", nil}}
+	}
+	return status
+}
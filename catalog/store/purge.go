@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/catalog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PurgeReport describes one purge run.
+type PurgeReport struct {
+	Cutoff     time.Time `json:"cutoff"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Products   []string  `json:"products"`
+	Languages  int64     `json:"languages"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// Purge permanently removes up to limit products whose deleteDate is before
+// cutoff, along with their product_languages documents. purged is called
+// after each product is gone, for example to publish a tombstone. A failure
+// on one product is added to the report and the run moves on; the error
+// returned is only for failing to list candidates.
+func (s *Products) Purge(ctx context.Context, cutoff time.Time, limit int, purged func(ctx context.Context, product *catalog.Product) error) (PurgeReport, error) {
+	report := PurgeReport{Cutoff: cutoff, StartedAt: time.Now().UTC(), Products: []string{}}
+	filter := bson.M{"deleteDate": bson.M{"$lt": cutoff}}
+
+	cursor, err := s.products.Find(ctx, filter, options.Find().SetLimit(int64(limit)))
+	if err != nil {
+		return report, err
+	}
+	var candidates []catalog.Product
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return report, err
+	}
+
+	for i := range candidates {
+		product := &candidates[i]
+		deleted, err := s.purgeOne(ctx, product, cutoff, &report)
+		if err != nil {
+			report.Errors = append(report.Errors, product.ID+": "+err.Error())
+		}
+		if deleted && purged != nil {
+			if err := purged(ctx, product); err != nil {
+				report.Errors = append(report.Errors, product.ID+": "+err.Error())
+			}
+		}
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+// purgeOne reports whether the product document was deleted, which can be
+// true even when removing its languages then fails.
+func (s *Products) purgeOne(ctx context.Context, product *catalog.Product, cutoff time.Time, report *PurgeReport) (bool, error) {
+	// Matching on deleteDate again skips a product restored, or purged by
+	// another instance, since the find.
+	result, err := s.products.DeleteOne(ctx, bson.M{"id": product.ID, "deleteDate": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return false, err
+	}
+	if result.DeletedCount == 0 {
+		return false, nil
+	}
+	report.Products = append(report.Products, product.ID)
+	s.Audit.Record(ctx, "purge", product.ID, product, nil)
+
+	ids := bson.A{}
+	for _, language := range product.SupportingLanguage {
+		if language != nil && language.ID != "" {
+			ids = append(ids, language.ID)
+		}
+	}
+	if len(ids) > 0 {
+		languages, err := s.languages.DeleteMany(ctx, bson.M{"id": bson.M{"$in": ids}})
+		if err != nil {
+			return true, err
+		}
+		report.Languages += languages.DeletedCount
+	}
+
+	return true, nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sing3demons/catalog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotDeleted = errors.New("product is not deleted")
+	// ErrRetentionExpired means the product is waiting to be purged and can
+	// no longer be restored.
+	ErrRetentionExpired = errors.New("product was deleted before the retention window")
+)
+
+// Restore clears deleteDate on a product deleted less than retention ago.
+func (s *Products) Restore(ctx context.Context, id string, retention time.Duration) (*catalog.Product, error) {
+	now := time.Now().UTC()
+	var before catalog.Product
+	err := s.products.FindOneAndUpdate(ctx, bson.M{
+		"id":         id,
+		"deleteDate": bson.M{"$gte": now.Add(-retention)},
+	}, bson.M{
+		"$unset": bson.M{"deleteDate": ""},
+		"$set":   bson.M{"updatedAt": now},
+	}).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, s.whyNotRestored(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	after := before
+	after.DeleteDate = nil
+	after.UpdatedAt = now
+	s.Audit.Record(ctx, "restore", id, &before, &after)
+	return &after, nil
+}
+
+func (s *Products) whyNotRestored(ctx context.Context, id string) error {
+	var product catalog.Product
+	err := s.products.FindOne(ctx, bson.M{"id": id}, options.FindOne().SetProjection(bson.M{"deleteDate": 1})).Decode(&product)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case err != nil:
+		return err
+	case product.DeleteDate == nil:
+		return ErrNotDeleted
+	default:
+		return ErrRetentionExpired
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sing3demons/catalog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrPriceNotFound      = errors.New("price not found")
+	ErrLanguageNotFound   = errors.New("language not found")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+)
+
+// Prices, languages and attachments follow the same lifecycle as products
+// but keep no status history of their own; the audit entry written for
+// each transition is their history.
+
+// TransitionPrice moves one of a product's prices to change.To if the
+// lifecycle allows it. The update only matches while the price still has
+// the status that was checked.
+func (s *Products) TransitionPrice(ctx context.Context, productID, priceID string, change catalog.StatusChange) (*catalog.Product, error) {
+	var current catalog.Product
+	err := s.products.FindOne(ctx, bson.M{"id": productID, "deleteDate": primitive.Null{}}).Decode(&current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var price *catalog.Price
+	for _, p := range current.Price {
+		if p != nil && p.ID == priceID {
+			price = p
+			break
+		}
+	}
+	if price == nil {
+		return nil, ErrPriceNotFound
+	}
+	if err := checkTransition(&change, price.Status); err != nil {
+		return nil, err
+	}
+
+	var updated catalog.Product
+	err = s.products.FindOneAndUpdate(ctx, bson.M{
+		"id":         productID,
+		"deleteDate": primitive.Null{},
+		"price":      bson.M{"$elemMatch": bson.M{"id": priceID, "status": statusFilter(price.Status)}},
+	}, bson.M{
+		"$set": bson.M{"price.$.status": change.To, "price.$.updatedAt": change.At, "updatedAt": change.At},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Audit.Record(ctx, "price.status", productID, &current, &updated)
+	return &updated, nil
+}
+
+// TransitionLanguage moves a language document in product_languages, or
+// one of its attachments when attachmentID is set, to change.To if the
+// lifecycle allows it. Languages are not tied to a single product, so the
+// audit entry is keyed by the language id.
+func (s *Products) TransitionLanguage(ctx context.Context, languageID, attachmentID string, change catalog.StatusChange) (*catalog.SupportingLanguage, error) {
+	var current catalog.SupportingLanguage
+	err := s.languages.FindOne(ctx, bson.M{"id": languageID}).Decode(&current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrLanguageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	action := "language.status"
+	filter := bson.M{"id": languageID}
+	var set bson.M
+	if attachmentID == "" {
+		if err := checkTransition(&change, current.Status); err != nil {
+			return nil, err
+		}
+		filter["status"] = statusFilter(current.Status)
+		set = bson.M{"status": change.To, "updatedAt": change.At}
+	} else {
+		var attachment *catalog.Attachment
+		for _, a := range current.Attachment {
+			if a != nil && a.ID == attachmentID {
+				attachment = a
+				break
+			}
+		}
+		if attachment == nil {
+			return nil, ErrAttachmentNotFound
+		}
+		if err := checkTransition(&change, attachment.Status); err != nil {
+			return nil, err
+		}
+		action = "attachment.status"
+		filter["attachment"] = bson.M{"$elemMatch": bson.M{"id": attachmentID, "status": statusFilter(attachment.Status)}}
+		set = bson.M{"attachment.$.status": change.To, "attachment.$.updatedAt": change.At, "updatedAt": change.At}
+	}
+
+	var updated catalog.SupportingLanguage
+	err = s.languages.FindOneAndUpdate(ctx, filter, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Audit.Record(ctx, action, languageID, &current, &updated)
+	return &updated, nil
+}
@@ -0,0 +1,219 @@
+package catalog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+)
+
+// FieldError is one failed rule. Field is the JSON path of the value, for
+// example price[0].tax.value.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule a document failed.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+type validator struct {
+	fields []FieldError
+}
+
+func (v *validator) add(field, format string, args ...any) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+// Validate checks a product as it arrives in a create event. It returns a
+// *ValidationError, or nil if the product is valid.
+func (p *Product) Validate() error {
+	v := &validator{}
+	if strings.TrimSpace(p.ID) == "" {
+		v.add("id", "is required")
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		v.add("name", "is required")
+	}
+	if p.Stock < 0 {
+		v.add("stock", "must not be negative")
+	}
+	if p.Status != "" && p.Status != StatusDraft && p.Status != StatusActive {
+		v.add("status", "a new product must be %q or %q", StatusDraft, StatusActive)
+	}
+
+	for i, price := range p.Price {
+		v.price(fmt.Sprintf("price[%d]", i), price)
+	}
+	v.windows(p.Price)
+	for i, category := range p.Category {
+		if category == nil {
+			v.add(fmt.Sprintf("category[%d]", i), "must not be null")
+			continue
+		}
+		v.status(fmt.Sprintf("category[%d].status", i), category.Status)
+	}
+	v.languages("SupportingLanguage", p.SupportingLanguage)
+	return v.err()
+}
+
+// Validate checks a category as it arrives in a create event.
+func (c *Category) Validate() error {
+	v := &validator{}
+	if strings.TrimSpace(c.ID) == "" {
+		v.add("id", "is required")
+	}
+	if strings.TrimSpace(c.Name) == "" {
+		v.add("name", "is required")
+	}
+	if c.ParentID != "" && c.ParentID == c.ID {
+		v.add("parentId", "must not be the category itself")
+	}
+	v.status("status", c.Status)
+	v.languages("SupportingLanguage", c.SupportingLanguage)
+	return v.err()
+}
+
+// Validate checks a full language document as stored in product_languages.
+func (l *SupportingLanguage) Validate() error {
+	v := &validator{}
+	if strings.TrimSpace(l.ID) == "" {
+		v.add("id", "is required")
+	}
+	v.language("", l)
+	return v.err()
+}
+
+func (v *validator) status(field string, s Status) {
+	if s != "" && !s.Valid() {
+		v.add(field, "unknown status %q", s)
+	}
+}
+
+func (v *validator) price(path string, price *Price) {
+	if price == nil {
+		v.add(path, "must not be null")
+		return
+	}
+	v.status(path+".status", price.Status)
+	if price.EffectiveFrom != nil && price.EffectiveTo != nil && !price.EffectiveTo.After(*price.EffectiveFrom) {
+		v.add(path+".effectiveTo", "must be after effectiveFrom")
+	}
+
+	if uom := price.UnitOfMeasure; uom != nil {
+		if uom.Amount.IsNegative() {
+			v.add(path+".unitOfMeasure.amount", "must not be negative")
+		}
+		v.currency(path+".unitOfMeasure.currency", uom.Currency)
+	}
+
+	if tax := price.Tax; tax != nil {
+		switch tax.Type {
+		case TaxPercentage:
+			if tax.Value.IsNegative() || tax.Value.GreaterThan(hundred) {
+				v.add(path+".tax.value", "must be between 0 and 100")
+			}
+		case TaxFixed:
+			if tax.Value.IsNegative() {
+				v.add(path+".tax.value", "must not be negative")
+			}
+		default:
+			v.add(path+".tax.type", "must be %q or %q", TaxPercentage, TaxFixed)
+		}
+	}
+	v.languages(path+".SupportingLanguage", price.SupportingLanguage)
+}
+
+// windows rejects two live prices of the same type whose validity
+// windows overlap, since the effective price would be ambiguous.
+func (v *validator) windows(prices []*Price) {
+	for i, a := range prices {
+		if a == nil || !a.Status.Live() {
+			continue
+		}
+		for j := i + 1; j < len(prices); j++ {
+			b := prices[j]
+			if b == nil || !b.Status.Live() || a.Type != b.Type {
+				continue
+			}
+			if a.overlaps(b) {
+				v.add(fmt.Sprintf("price[%d].effectiveFrom", j), "overlaps price[%d] of type %q", i, a.Type)
+			}
+		}
+	}
+}
+
+var hundred = decimal.NewFromInt(100)
+
+func (v *validator) currency(field, code string) {
+	if code == "" {
+		v.add(field, "is required")
+		return
+	}
+	if _, err := currency.ParseISO(code); err != nil || code != strings.ToUpper(code) {
+		v.add(field, "%q is not an ISO 4217 currency code", code)
+	}
+}
+
+// languages validates a SupportingLanguage list and rejects two entries
+// with the same languageCode.
+func (v *validator) languages(path string, languages []*SupportingLanguage) {
+	seen := map[string]int{}
+	for i, l := range languages {
+		field := fmt.Sprintf("%s[%d]", path, i)
+		if l == nil {
+			v.add(field, "must not be null")
+			continue
+		}
+		v.language(field+".", l)
+
+		code := strings.ToLower(l.LanguageCode)
+		if first, ok := seen[code]; ok && code != "" {
+			v.add(field+".languageCode", "duplicates %s[%d]", path, first)
+			continue
+		}
+		seen[code] = i
+	}
+}
+
+func (v *validator) language(prefix string, l *SupportingLanguage) {
+	if l.LanguageCode == "" {
+		v.add(prefix+"languageCode", "is required")
+	} else if _, err := language.Parse(l.LanguageCode); err != nil {
+		v.add(prefix+"languageCode", "%q is not a BCP 47 language tag", l.LanguageCode)
+	}
+	v.status(prefix+"status", l.Status)
+	if uom := l.UnitOfMeasure; uom != nil && uom.Currency != "" {
+		v.currency(prefix+"unitOfMeasure.currency", uom.Currency)
+	}
+	for i, a := range l.Attachment {
+		field := fmt.Sprintf("%sattachment[%d]", prefix, i)
+		if a == nil {
+			v.add(field, "must not be null")
+			continue
+		}
+		v.status(field+".status", a.Status)
+		if a.Display != nil && a.Display.Type != "" && !a.Display.Type.Valid() {
+			v.add(field+".display.type", "unknown display type %q", a.Display.Type)
+		}
+	}
+}
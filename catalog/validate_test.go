@@ -0,0 +1,150 @@
+package catalog
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func validProduct() *Product {
+	return &Product{
+		ID:   "p1",
+		Name: "Coffee",
+		Price: []*Price{{
+			ID:            "price1",
+			Type:          "regular",
+			UnitOfMeasure: &UnitOfMeasure{Unit: "cup", Currency: "THB"},
+			Tax:           &Tax{Type: TaxPercentage},
+		}},
+		SupportingLanguage: []*SupportingLanguage{{LanguageCode: "th"}},
+	}
+}
+
+func TestProductValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *Product)
+		fields []string
+	}{
+		{
+			name:   "valid",
+			modify: func(p *Product) {},
+		},
+		{
+			name:   "missing id and name",
+			modify: func(p *Product) { p.ID, p.Name = "", " " },
+			fields: []string{"id", "name"},
+		},
+		{
+			name:   "negative stock",
+			modify: func(p *Product) { p.Stock = -1 },
+			fields: []string{"stock"},
+		},
+		{
+			name:   "unknown status",
+			modify: func(p *Product) { p.Status = "bogus" },
+			fields: []string{"status"},
+		},
+		{
+			name:   "new product cannot start suspended",
+			modify: func(p *Product) { p.Status = StatusSuspended },
+			fields: []string{"status"},
+		},
+		{
+			name:   "currency symbol",
+			modify: func(p *Product) { p.Price[0].UnitOfMeasure.Currency = "฿" },
+			fields: []string{"price[0].unitOfMeasure.currency"},
+		},
+		{
+			name:   "lowercase currency",
+			modify: func(p *Product) { p.Price[0].UnitOfMeasure.Currency = "thb" },
+			fields: []string{"price[0].unitOfMeasure.currency"},
+		},
+		{
+			name:   "percentage over 100",
+			modify: func(p *Product) { p.Price[0].Tax.Value = amount(t, "100.01") },
+			fields: []string{"price[0].tax.value"},
+		},
+		{
+			name:   "unknown tax type",
+			modify: func(p *Product) { p.Price[0].Tax.Type = "vat" },
+			fields: []string{"price[0].tax.type"},
+		},
+		{
+			name:   "empty window",
+			modify: func(p *Product) { p.Price[0].EffectiveFrom, p.Price[0].EffectiveTo = at(10), at(10) },
+			fields: []string{"price[0].effectiveTo"},
+		},
+		{
+			name: "overlapping prices of one type",
+			modify: func(p *Product) {
+				p.Price[0].EffectiveTo = at(11)
+				p.Price = append(p.Price, &Price{Type: "regular", EffectiveFrom: at(10)})
+			},
+			fields: []string{"price[1].effectiveFrom"},
+		},
+		{
+			name: "overlap with a suspended price is allowed",
+			modify: func(p *Product) {
+				p.Price = append(p.Price, &Price{Type: "regular", Status: StatusSuspended})
+			},
+		},
+		{
+			name: "overlap across types is allowed",
+			modify: func(p *Product) {
+				p.Price = append(p.Price, &Price{Type: "promotion"})
+			},
+		},
+		{
+			name: "duplicate language",
+			modify: func(p *Product) {
+				p.SupportingLanguage = append(p.SupportingLanguage, &SupportingLanguage{LanguageCode: "TH"})
+			},
+			fields: []string{"SupportingLanguage[1].languageCode"},
+		},
+		{
+			name:   "invalid language tag",
+			modify: func(p *Product) { p.SupportingLanguage[0].LanguageCode = "not a tag!" },
+			fields: []string{"SupportingLanguage[0].languageCode"},
+		},
+		{
+			name: "nested statuses",
+			modify: func(p *Product) {
+				p.Category = []*Category{{Status: "bogus"}}
+				p.SupportingLanguage[0].Attachment = []*Attachment{{Status: "bogus"}}
+			},
+			fields: []string{"category[0].status", "SupportingLanguage[0].attachment[0].status"},
+		},
+		{
+			name:   "null price",
+			modify: func(p *Product) { p.Price = append(p.Price, nil) },
+			fields: []string{"price[1]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := validProduct()
+			tt.modify(p)
+			err := p.Validate()
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			var fields []string
+			for _, f := range invalid.Fields {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("failed fields = %q, want %q", fields, tt.fields)
+			}
+		})
+	}
+}
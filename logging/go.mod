@@ -0,0 +1,7 @@
+module github.com/sing3demons/logging
+
+go 1.21.6
+
+require github.com/sirupsen/logrus v1.9.3
+
+require golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
@@ -0,0 +1,110 @@
+// Package logging holds the log conventions shared by node-products and
+// service_consumer: correlation ids, the logrus entry carried in a context
+// and the field names both services use.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Field names used by both services.
+const (
+	FieldCorrelationID = "correlationId"
+	FieldTopic         = "topic"
+	FieldPartition     = "partition"
+	FieldOffset        = "offset"
+	FieldKey           = "key"
+	FieldPayload       = "payload"
+	FieldHeaders       = "headers"
+	FieldMethod        = "method"
+	FieldPath          = "path"
+	FieldRoute         = "route"
+	FieldStatus        = "status"
+	FieldDurationMs    = "durationMs"
+	FieldError         = "error"
+)
+
+// HeaderCorrelationID is the header carrying the id in HTTP requests,
+// responses and Kafka messages.
+const HeaderCorrelationID = "X-Correlation-Id"
+
+// httpHeaders are checked in order when a request arrives.
+var httpHeaders = []string{HeaderCorrelationID, "X-Request-Id"}
+
+// NewID returns a random UUID v4.
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// FromHTTP returns the caller's correlation id, or a new one.
+func FromHTTP(h http.Header) string {
+	for _, name := range httpHeaders {
+		if id := strings.TrimSpace(h.Get(name)); id != "" {
+			return id
+		}
+	}
+	return NewID()
+}
+
+// FromKafka returns the correlation id from message headers, or a new one.
+// Header names are matched case-insensitively because producers differ.
+func FromKafka(headers map[string]string) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, HeaderCorrelationID) && value != "" {
+			return value
+		}
+	}
+	for name, value := range headers {
+		if strings.EqualFold(name, "x-session-id") && value != "" {
+			return value
+		}
+	}
+	return NewID()
+}
+
+type entryKey struct{}
+type correlationIDKey struct{}
+
+// WithCorrelationID stores id in ctx.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the id stored in ctx, if any.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// NewContext derives an entry tagged with id from logger and stores both in ctx.
+func NewContext(ctx context.Context, logger *logrus.Logger, id string) (context.Context, *logrus.Entry) {
+	entry := logger.WithField(FieldCorrelationID, id)
+	ctx = WithCorrelationID(ctx, id)
+	return context.WithValue(ctx, entryKey{}, entry), entry
+}
+
+// WithFields adds fields to the entry in ctx and stores the result back.
+func WithFields(ctx context.Context, fields logrus.Fields) (context.Context, *logrus.Entry) {
+	entry := FromContext(ctx).WithFields(fields)
+	return context.WithValue(ctx, entryKey{}, entry), entry
+}
+
+// FromContext returns the entry stored by NewContext, or one on the
+// standard logger so callers never need a nil check.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(entryKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MaxPayload is the default number of bytes of a payload that is logged.
+const MaxPayload = 512
+
+const redacted = "[REDACTED]"
+
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "apikey", "api_key", "cookie"}
+
+// Truncate cuts s to max bytes and notes how much was dropped.
+func Truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	return fmt.Sprintf("%s...(%d more bytes)", s[:max], len(s)-max)
+}
+
+// Payload prepares a message body for logging: JSON values under sensitive
+// keys are replaced and the result is truncated to max bytes.
+func Payload(b []byte, max int) string {
+	var v any
+	if err := json.Unmarshal(b, &v); err == nil {
+		if out, err := json.Marshal(redact(v)); err == nil {
+			b = out
+		}
+	}
+	return Truncate(string(b), max)
+}
+
+func redact(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if isSensitive(k) {
+				t[k] = redacted
+			} else {
+				t[k] = redact(val)
+			}
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = redact(val)
+		}
+	}
+	return v
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+module github.com/sing3demons/mongometrics
+
+go 1.21.6
+
+require (
+	github.com/prometheus/client_golang v1.19.1
+	go.mongodb.org/mongo-driver v1.13.1
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
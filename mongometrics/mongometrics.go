@@ -0,0 +1,54 @@
+// Package mongometrics measures MongoDB command latency the same way in
+// every service, so one dashboard covers node-products and service_consumer.
+package mongometrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Monitor registers mongo_command_duration_seconds{collection,command,status}
+// with reg and returns a monitor that times every command sent by the
+// client. The collection name is only present on the started event, so it
+// is kept until the command ends.
+func Monitor(reg prometheus.Registerer) *event.CommandMonitor {
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "mongo",
+		Name:      "command_duration_seconds",
+		Help:      "MongoDB command latency by collection, command and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"collection", "command", "status"})
+	reg.MustRegister(latency)
+
+	var collections sync.Map
+
+	finish := func(requestID int64, command string, duration time.Duration, status string) {
+		collection := ""
+		if v, ok := collections.LoadAndDelete(requestID); ok {
+			collection = v.(string)
+		}
+		latency.WithLabelValues(collection, command, status).Observe(duration.Seconds())
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			key := e.CommandName
+			if key == "getMore" {
+				key = "collection"
+			}
+			if name, ok := e.Command.Lookup(key).StringValueOK(); ok {
+				collections.Store(e.RequestID, name)
+			}
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, e.CommandName, e.Duration, "ok")
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, e.CommandName, e.Duration, "error")
+		},
+	}
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		ops     func(c *LRU[string, int])
+		present []string
+		absent  []string
+		evicted uint64
+	}{
+		{
+			name: "evicts the least recently set",
+			size: 2,
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Set("c", 3)
+			},
+			present: []string{"b", "c"},
+			absent:  []string{"a"},
+			evicted: 1,
+		},
+		{
+			name: "get refreshes recency",
+			size: 2,
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Get("a")
+				c.Set("c", 3)
+			},
+			present: []string{"a", "c"},
+			absent:  []string{"b"},
+			evicted: 1,
+		},
+		{
+			name: "overwriting does not evict",
+			size: 2,
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Set("a", 3)
+			},
+			present: []string{"a", "b"},
+		},
+		{
+			name: "size below one holds one entry",
+			size: 0,
+			ops: func(c *LRU[string, int]) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+			},
+			present: []string{"b"},
+			absent:  []string{"a"},
+			evicted: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int](tt.size, time.Minute)
+			tt.ops(c)
+			if got := c.Stats().Evictions; got != tt.evicted {
+				t.Errorf("evictions = %d, want %d", got, tt.evicted)
+			}
+			for _, key := range tt.present {
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("Get(%q) missed, want a hit", key)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := c.Get(key); ok {
+					t.Errorf("Get(%q) hit, want a miss", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		wait time.Duration
+		hit  bool
+	}{
+		{"fresh", time.Minute, 0, true},
+		{"expired", 10 * time.Millisecond, 20 * time.Millisecond, false},
+		{"no ttl never expires", 0, 20 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int](10, tt.ttl)
+			c.Set("a", 1)
+			time.Sleep(tt.wait)
+			if _, ok := c.Get("a"); ok != tt.hit {
+				t.Errorf("Get() hit = %v, want %v", ok, tt.hit)
+			}
+			if !tt.hit && c.Len() != 0 {
+				t.Errorf("Len() = %d after expiry, want 0", c.Len())
+			}
+		})
+	}
+}
+
+func TestLRUSetRenewsTTL(t *testing.T) {
+	c := New[string, int](10, 30*time.Millisecond)
+	c.Set("a", 1)
+	time.Sleep(20 * time.Millisecond)
+	c.Set("a", 2)
+	time.Sleep(20 * time.Millisecond)
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Errorf("Get() = %d, %v, want 2, true", v, ok)
+	}
+}
+
+func TestLRUDeleteFunc(t *testing.T) {
+	c := New[string, int](10, time.Minute)
+	for _, key := range []string{"p1:en", "p1:th", "p2:en"} {
+		c.Set(key, 1)
+	}
+	removed := c.DeleteFunc(func(key string) bool { return key[:2] == "p1" })
+	if removed != 2 {
+		t.Errorf("DeleteFunc() = %d, want 2", removed)
+	}
+
+	c.Get("p1:en")
+	c.Get("p2:en")
+	want := Stats{Hits: 1, Misses: 1, Invalidations: 2, Size: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
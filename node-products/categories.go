@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/catalog"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/service-products/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func registerCategories(r *gin.Engine, categories *store.Categories, collection *mongo.Collection, publisher events.Publisher, invalidate func(id string)) {
+	r.GET("/categories", categoryTree(categories))
+	r.POST("/categories/:id/status", changeCategoryStatus(categories, publisher, invalidate))
+	r.GET("/categories/:id/products", deletedForAdmins, categoryProducts(categories, collection))
+}
+
+// categoryTree handles GET /categories, returning every category nested
+// under its parent.
+func categoryTree(categories *store.Categories) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		all, err := categories.All(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"categories": catalog.BuildTree(all),
+		})
+	}
+}
+
+// categoryProducts handles GET /categories/:id/products. It lists the
+// products in the category or any category below it, with the same status
+// and price filters as GET /products. ?limit= is capped at 100, the page
+// size GET /products returns.
+func categoryProducts(categories *store.Categories, collection *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = min(limit, 100)
+		at, err := priceTime(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		ids, err := categories.Subtree(ctx, c.Param("id"))
+		if errors.Is(err, store.ErrCategoryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		filter := productFilter(c)
+		filter["category.id"] = bson.M{"$in": ids}
+
+		total, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		opts := options.Find().SetProjection(bson.M{"_id": 0}).SetLimit(limit)
+		cursor, err := collection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		baseURL := fmt.Sprintf("%s://%s/products", scheme, c.Request.Host)
+
+		products := []catalog.Product{}
+		for cursor.Next(ctx) {
+			var product catalog.Product
+			if err := cursor.Decode(&product); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			product.Href = fmt.Sprintf("%s/%s", baseURL, product.ID)
+			product.Price = product.EffectivePrices(at)
+			product.ComputeTotals()
+
+			products = append(products, product)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"products": products,
+			"total":    total,
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Package events publishes the Kafka events node-products emits, with the
+// same headers node-service and service_consumer put on theirs.
+package events
+
+import (
+	"context"
+
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/produce"
+	"github.com/sirupsen/logrus"
+)
+
+const systemID = "node-products"
+
+// Publisher sends an event keyed by key, which should be the product id so
+// every event for one product stays ordered on one partition.
+type Publisher interface {
+	Publish(ctx context.Context, topic, key string, body any) error
+	Close() error
+}
+
+type kafkaPublisher struct {
+	producer *produce.SyncProducer
+}
+
+// NewPublisher connects an idempotent synchronous producer.
+func NewPublisher(brokers []string) (Publisher, error) {
+	producer, err := produce.NewSyncProducer(brokers, produce.NewConfig(systemID))
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaPublisher{producer: producer}, nil
+}
+
+// Publish sends body with the topic as its message type.
+func (p *kafkaPublisher) Publish(ctx context.Context, topic, key string, body any) error {
+	return p.producer.Publish(ctx, topic, produce.Event{
+		Key:  key,
+		Type: topic,
+		Body: body,
+	})
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.producer.Close()
+}
+
+type logPublisher struct{}
+
+// NewLogPublisher returns a Publisher that only logs, for running without
+// Kafka.
+func NewLogPublisher() Publisher {
+	return logPublisher{}
+}
+
+func (p logPublisher) Publish(ctx context.Context, topic, key string, body any) error {
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		logging.FieldTopic: topic,
+		logging.FieldKey:   key,
+	}).Warn("KAFKA_BROKERS is empty, event not published")
+	return nil
+}
+
+func (p logPublisher) Close() error { return nil }
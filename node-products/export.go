@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/catalog"
+	"github.com/sing3demons/logging"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var exportColumns = []string{
+	"id", "name", "description", "status", "stock",
+	"priceName", "amount", "currency", "unit", "taxType", "taxValue",
+	"categories", "languageCode", "languageName", "languageDescription",
+	"createdAt", "updatedAt",
+}
+
+// exportRow flattens a product into exportColumns order. Only the first
+// price effective at at is exported, as GET /products would list it, and
+// lang selects which SupportingLanguage is used.
+func exportRow(product catalog.Product, lang string, at time.Time) []string {
+	var priceName, amount, currency, unit, taxType, taxValue string
+	if prices := product.EffectivePrices(at); len(prices) > 0 {
+		price := prices[0]
+		priceName = price.Name
+		if price.UnitOfMeasure != nil {
+			amount = price.UnitOfMeasure.Amount.String()
+			currency = price.UnitOfMeasure.Currency
+			unit = price.UnitOfMeasure.Unit
+		}
+		if price.Tax != nil {
+			taxType = string(price.Tax.Type)
+			taxValue = price.Tax.Value.String()
+		}
+	}
+
+	categories := []string{}
+	for _, category := range product.Category {
+		if category != nil {
+			categories = append(categories, category.Name)
+		}
+	}
+
+	var languageCode, languageName, languageDescription string
+	if lang != "" {
+		if languages := filterLanguage(product.SupportingLanguage, lang); len(languages) > 0 {
+			languageCode = languages[0].LanguageCode
+			languageName = languages[0].Name
+			languageDescription = languages[0].Description
+		}
+	}
+
+	return []string{
+		product.ID, product.Name, product.Description, string(product.Status), strconv.Itoa(product.Stock),
+		priceName, amount, currency, unit, taxType, taxValue,
+		strings.Join(categories, "|"), languageCode, languageName, languageDescription,
+		formatTime(product.CreatedAt), formatTime(product.UpdatedAt),
+	}
+}
+
+func exportProducts(collection *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", "csv")
+		if format != "csv" && format != "xlsx" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("unsupported format %q, expected csv or xlsx", format),
+			})
+			return
+		}
+
+		at, err := priceTime(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+		defer cancel()
+
+		cursor, err := collection.Find(ctx, productFilter(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		filename := fmt.Sprintf("products-%s.%s", time.Now().Format("20060102150405"), format)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+		lang := c.Query("lang")
+		if format == "xlsx" {
+			err = writeXLSX(ctx, c, cursor, lang, at)
+		} else {
+			err = writeCSV(ctx, c, cursor, lang, at)
+		}
+		if err != nil {
+			logging.FromContext(ctx).WithField(logging.FieldError, err).Error("export products")
+		}
+	}
+}
+
+func writeCSV(ctx context.Context, c *gin.Context, cursor *mongo.Cursor, lang string, at time.Time) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(exportColumns); err != nil {
+		return err
+	}
+
+	n := 0
+	for cursor.Next(ctx) {
+		var product catalog.Product
+		if err := cursor.Decode(&product); err != nil {
+			logging.FromContext(ctx).WithField(logging.FieldError, err).Error("decode product")
+			continue
+		}
+		if err := w.Write(exportRow(product, lang, at)); err != nil {
+			return err
+		}
+
+		n++
+		if n%100 == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return cursor.Err()
+}
+
+// writeXLSX uses excelize's stream writer, which spills rows to a temp
+// file instead of building the whole sheet in memory.
+func writeXLSX(ctx context.Context, c *gin.Context, cursor *mongo.Cursor, lang string, at time.Time) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Products"
+	f.SetSheetName("Sheet1", sheet)
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return err
+	}
+
+	if err := sw.SetRow("A1", toCells(exportColumns)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return err
+	}
+
+	row := 2
+	for cursor.Next(ctx) {
+		var product catalog.Product
+		if err := cursor.Decode(&product); err != nil {
+			logging.FromContext(ctx).WithField(logging.FieldError, err).Error("decode product")
+			continue
+		}
+
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		if err := sw.SetRow(cell, toCells(exportRow(product, lang, at))); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return err
+		}
+		row++
+	}
+	if err := cursor.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return err
+	}
+	if err := sw.Flush(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return err
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Status(http.StatusOK)
+	return f.Write(c.Writer)
+}
+
+// formatTime leaves unset timestamps empty instead of printing year 1.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func toCells(values []string) []interface{} {
+	cells := make([]interface{}, len(values))
+	for i, v := range values {
+		cells[i] = v
+	}
+	return cells
+}
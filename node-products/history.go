@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/catalog/store"
+)
+
+// productHistory handles GET /products/:id/history. ?limit= caps the number
+// of entries, newest first, at 500.
+func productHistory(audit *store.Audit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = min(limit, 500)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		history, err := audit.History(ctx, c.Param("id"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"history": history,
+		})
+	}
+}
@@ -0,0 +1,322 @@
+// Package inventory reserves product stock for orders. A reservation takes
+// stock off Product.Stock straight away and is then committed by the order
+// service, released, or released automatically once it expires. Releases
+// run in a transaction, so MongoDB must be a replica set.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sing3demons/catalog"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/service-products/events"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Topics the store publishes to. Both are keyed by product id.
+const (
+	TopicReserved = "stock.reserved"
+	TopicReleased = "stock.released"
+)
+
+var (
+	ErrProductNotFound   = errors.New("product not found")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrNotAvailable is returned for products that exist but are not
+	// active, so they cannot be sold.
+	ErrNotAvailable        = errors.New("product is not available")
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrNotReserved is returned when a reservation has already been
+	// committed, released or expired.
+	ErrNotReserved = errors.New("reservation is not active")
+)
+
+type Status string
+
+const (
+	StatusReserved  Status = "reserved"
+	StatusCommitted Status = "committed"
+	StatusReleased  Status = "released"
+	StatusExpired   Status = "expired"
+)
+
+type Reservation struct {
+	ID        string     `json:"id" bson:"id"`
+	ProductID string     `json:"productId" bson:"productId"`
+	Quantity  int        `json:"quantity" bson:"quantity"`
+	Status    Status     `json:"status" bson:"status"`
+	ExpiresAt time.Time  `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	ClosedAt  *time.Time `json:"closedAt,omitempty" bson:"closedAt,omitempty"`
+}
+
+// Event is the body of stock.reserved and stock.released.
+type Event struct {
+	ReservationID string    `json:"reservationId"`
+	ProductID     string    `json:"productId"`
+	Quantity      int       `json:"quantity"`
+	Status        Status    `json:"status"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+type Store struct {
+	products     *mongo.Collection
+	reservations *mongo.Collection
+	publisher    events.Publisher
+	audit        *store.Audit
+
+	// Retention is how long closed reservations are kept before Mongo's
+	// TTL monitor deletes them.
+	Retention time.Duration
+}
+
+func NewStore(db *mongo.Database, publisher events.Publisher, audit *store.Audit) *Store {
+	return &Store{
+		products:     db.Collection("products"),
+		reservations: db.Collection("stock_reservations"),
+		publisher:    publisher,
+		audit:        audit,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// EnsureIndexes creates the reservation indexes. closedAt carries the TTL
+// so open reservations are never deleted before they are released.
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	_, err := s.reservations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}}},
+		{Keys: bson.D{{Key: "closedAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(s.Retention.Seconds()))},
+	})
+	return err
+}
+
+// liveStatus matches the statuses catalog.Status.Live accepts, including
+// products stored without one.
+var liveStatus = bson.M{"$in": bson.A{catalog.StatusActive, "", nil}}
+
+// Reserve takes quantity off the product's stock if enough is left. The
+// update is conditional on stock >= quantity, so concurrent reservations
+// can never drive stock negative. Only live products can be reserved.
+func (s *Store) Reserve(ctx context.Context, productID string, quantity int, ttl time.Duration) (*Reservation, error) {
+	now := time.Now().UTC()
+	var before struct {
+		Stock int `bson:"stock"`
+	}
+	err := s.products.FindOneAndUpdate(ctx, bson.M{
+		"id":         productID,
+		"deleteDate": primitive.Null{},
+		"status":     liveStatus,
+		"stock":      bson.M{"$gte": quantity},
+	}, bson.M{
+		"$inc": bson.M{"stock": -quantity},
+		"$set": bson.M{"updatedAt": now},
+	}, options.FindOneAndUpdate().SetProjection(bson.M{"stock": 1})).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, s.whyNotReserved(ctx, productID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.recordStock(ctx, TopicReserved, productID, before.Stock, before.Stock-quantity)
+
+	reservation := &Reservation{
+		ID:        primitive.NewObjectID().Hex(),
+		ProductID: productID,
+		Quantity:  quantity,
+		Status:    StatusReserved,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if _, err := s.reservations.InsertOne(ctx, reservation); err != nil {
+		stock, restocked, restoreErr := s.restock(ctx, productID, quantity)
+		if restoreErr != nil {
+			logging.FromContext(ctx).WithFields(logrus.Fields{
+				"productId":        productID,
+				"quantity":         quantity,
+				logging.FieldError: restoreErr,
+			}).Error("stock lost after failed reservation insert")
+		} else if restocked {
+			s.recordStock(ctx, TopicReleased, productID, stock, stock+quantity)
+		}
+		return nil, err
+	}
+
+	s.publish(ctx, TopicReserved, reservation)
+	return reservation, nil
+}
+
+// Commit marks the reservation as fulfilled. The stock stays taken.
+func (s *Store) Commit(ctx context.Context, id string) (*Reservation, error) {
+	return s.close(ctx, bson.M{"id": id, "status": StatusReserved, "expiresAt": bson.M{"$gt": time.Now()}}, StatusCommitted)
+}
+
+// Release cancels the reservation and puts its stock back.
+func (s *Store) Release(ctx context.Context, id string) (*Reservation, error) {
+	return s.release(ctx, bson.M{"id": id, "status": StatusReserved}, StatusReleased)
+}
+
+// ExpireDue releases every reservation whose expiresAt has passed and
+// returns how many it released.
+func (s *Store) ExpireDue(ctx context.Context) (int, error) {
+	n := 0
+	for {
+		_, err := s.release(ctx, bson.M{"status": StatusReserved, "expiresAt": bson.M{"$lte": time.Now()}}, StatusExpired)
+		if errors.Is(err, ErrReservationNotFound) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// RunExpiry calls ExpireDue every interval until ctx is cancelled.
+func (s *Store) RunExpiry(ctx context.Context, interval time.Duration, logger *logrus.Logger) {
+	ctx = store.WithSource(ctx, store.Source{Kind: "job", Job: "reservation-expiry"})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.ExpireDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.WithField(logging.FieldError, err).Error("expire reservations")
+			}
+			if n > 0 {
+				logger.WithField("expired", n).Info("reservations expired")
+			}
+		}
+	}
+}
+
+// release closes one reservation matching filter and returns its stock in
+// a single transaction, so a failed restock leaves the reservation open to
+// be released again instead of losing the stock.
+func (s *Store) release(ctx context.Context, filter bson.M, status Status) (*Reservation, error) {
+	session, err := s.products.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	var reservation *Reservation
+	var stock int
+	var restocked bool
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		var err error
+		if reservation, err = s.close(ctx, filter, status); err != nil {
+			return nil, err
+		}
+		stock, restocked, err = s.restock(ctx, reservation.ProductID, reservation.Quantity)
+		return nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if restocked {
+		s.recordStock(ctx, TopicReleased, reservation.ProductID, stock, stock+reservation.Quantity)
+	}
+	s.publish(ctx, TopicReleased, reservation)
+	return reservation, nil
+}
+
+// close moves one reservation matching filter from reserved to status. Only
+// one caller can win the transition, so stock is never returned twice.
+func (s *Store) close(ctx context.Context, filter bson.M, status Status) (*Reservation, error) {
+	now := time.Now().UTC()
+	var reservation Reservation
+	err := s.reservations.FindOneAndUpdate(ctx, filter, bson.M{
+		"$set": bson.M{"status": status, "closedAt": now},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&reservation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if id, ok := filter["id"]; ok {
+			n, countErr := s.reservations.CountDocuments(ctx, bson.M{"id": id})
+			if countErr != nil {
+				return nil, countErr
+			}
+			if n > 0 {
+				return nil, ErrNotReserved
+			}
+		}
+		return nil, ErrReservationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+func (s *Store) whyNotReserved(ctx context.Context, productID string) error {
+	var product struct {
+		Status catalog.Status `bson:"status"`
+	}
+	err := s.products.FindOne(ctx, bson.M{"id": productID, "deleteDate": primitive.Null{}},
+		options.FindOne().SetProjection(bson.M{"status": 1})).Decode(&product)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrProductNotFound
+	case err != nil:
+		return err
+	case !product.Status.Live():
+		return ErrNotAvailable
+	default:
+		return ErrInsufficientStock
+	}
+}
+
+// restock puts quantity back on the product and returns the stock it had
+// before. restocked is false when the product has been purged, since there
+// is no stock to return. The caller records the change once it is committed.
+func (s *Store) restock(ctx context.Context, productID string, quantity int) (before int, restocked bool, err error) {
+	var product struct {
+		Stock int `bson:"stock"`
+	}
+	err = s.products.FindOneAndUpdate(ctx, bson.M{"id": productID}, bson.M{
+		"$inc": bson.M{"stock": quantity},
+		"$set": bson.M{"updatedAt": time.Now().UTC()},
+	}, options.FindOneAndUpdate().SetProjection(bson.M{"stock": 1})).Decode(&product)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return product.Stock, true, nil
+}
+
+func (s *Store) recordStock(ctx context.Context, action, productID string, before, after int) {
+	err := s.audit.Append(ctx, action, productID, []store.Change{{Path: "stock", Before: before, After: after}})
+	if err != nil && s.audit.OnError != nil {
+		s.audit.OnError(ctx, err)
+	}
+}
+
+// publish logs rather than fails: the stock change is already stored.
+func (s *Store) publish(ctx context.Context, topic string, r *Reservation) {
+	err := s.publisher.Publish(ctx, topic, r.ProductID, Event{
+		ReservationID: r.ID,
+		ProductID:     r.ProductID,
+		Quantity:      r.Quantity,
+		Status:        r.Status,
+		Timestamp:     time.Now().UTC(),
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithFields(logrus.Fields{
+			logging.FieldTopic: topic,
+			"reservationId":    r.ID,
+			logging.FieldError: err,
+		}).Error("publish stock event")
+	}
+}
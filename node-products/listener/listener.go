@@ -0,0 +1,99 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/sing3demons/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// HandlerFunc is called for every message received on the subscribed topics.
+// ctx carries a log entry tagged with the message's correlation id.
+type HandlerFunc func(ctx context.Context, topic string, key, value []byte)
+
+// Listen consumes every partition of topics from the newest offset without
+// joining a consumer group, so every instance receives every event and
+// nothing is left behind in the broker when it goes away. fn is called until
+// ctx is cancelled. Partitions added after Listen returns are not picked up.
+//
+// Without a group there is no committed offset to resume from, so events
+// published while an instance is down or restarting are never delivered to
+// it. Whatever fn maintains must tolerate missed events, as the product
+// cache does by expiring entries after PRODUCT_CACHE_TTL.
+func Listen(ctx context.Context, logger *logrus.Logger, brokers []string, topics []string, fn HandlerFunc) error {
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+
+	version, err := sarama.ParseKafkaVersion("1.0.0")
+	if err != nil {
+		return err
+	}
+	config.Version = version
+
+	consumer, err := sarama.NewConsumer(brokers, config)
+	if err != nil {
+		return err
+	}
+
+	var claims []sarama.PartitionConsumer
+	for _, topic := range topics {
+		partitions, err := consumer.Partitions(topic)
+		if err != nil {
+			closeAll(consumer, claims)
+			return fmt.Errorf("list partitions of %s: %w", topic, err)
+		}
+		for _, partition := range partitions {
+			claim, err := consumer.ConsumePartition(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				closeAll(consumer, claims)
+				return fmt.Errorf("consume %s/%d: %w", topic, partition, err)
+			}
+			claims = append(claims, claim)
+		}
+	}
+
+	for _, claim := range claims {
+		go func(claim sarama.PartitionConsumer) {
+			for msg := range claim.Messages() {
+				handle(ctx, logger, fn, msg)
+			}
+		}(claim)
+		go func(claim sarama.PartitionConsumer) {
+			for err := range claim.Errors() {
+				logger.WithField(logging.FieldError, err).Error("listener")
+			}
+		}(claim)
+	}
+
+	go func() {
+		<-ctx.Done()
+		closeAll(consumer, claims)
+	}()
+
+	return nil
+}
+
+func handle(ctx context.Context, logger *logrus.Logger, fn HandlerFunc, msg *sarama.ConsumerMessage) {
+	headers := map[string]string{}
+	for _, header := range msg.Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+
+	ctx, _ = logging.NewContext(ctx, logger, logging.FromKafka(headers))
+	ctx, _ = logging.WithFields(ctx, logrus.Fields{
+		logging.FieldTopic:     msg.Topic,
+		logging.FieldPartition: msg.Partition,
+		logging.FieldOffset:    msg.Offset,
+		logging.FieldKey:       string(msg.Key),
+	})
+	fn(ctx, msg.Topic, msg.Key, msg.Value)
+}
+
+func closeAll(consumer sarama.Consumer, claims []sarama.PartitionConsumer) {
+	for _, claim := range claims {
+		claim.AsyncClose()
+	}
+	consumer.Close()
+}
@@ -2,39 +2,149 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sing3demons/catalog"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/mongometrics"
+	"github.com/sing3demons/service-products/cache"
+	"github.com/sing3demons/service-products/events"
+	"github.com/sing3demons/service-products/inventory"
+	"github.com/sing3demons/service-products/listener"
+	"github.com/sing3demons/service-products/metrics"
+	"github.com/sing3demons/service-products/middleware"
+	"github.com/sing3demons/tracing"
+	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+var logger *logrus.Logger
+
 func init() {
 	godotenv.Load(".env")
+	logger = logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetOutput(os.Stdout)
+	logger.SetLevel(logrus.InfoLevel)
 }
 
 func main() {
+	shutdownTracing, err := tracing.Init(context.Background(), "node-products")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	db, err := ConnectMonoDB()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
+	appCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
 	collection := db.Database("products").Collection("products")
 
-	r := gin.Default()
+	productCache := newProductCache()
+	expvar.Publish("product_cache", expvar.Func(func() any {
+		return productCache.Stats()
+	}))
+
+	publisher := events.NewLogPublisher()
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		topics := []string{"update.products", "delete.products", inventory.TopicReserved, inventory.TopicReleased}
+		// Serving from a cache nothing invalidates would return stale
+		// products for up to PRODUCT_CACHE_TTL, so refuse to start instead.
+		if err := listener.Listen(appCtx, logger, strings.Split(brokers, ","), topics, invalidateProduct(productCache)); err != nil {
+			logger.WithField(logging.FieldError, err).Error("start cache invalidation listener")
+			os.Exit(1)
+		}
+		if publisher, err = events.NewPublisher(strings.Split(brokers, ",")); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	} else {
+		logger.Warn("KAFKA_BROKERS is empty, cache invalidation and event publishing disabled")
+	}
+	defer publisher.Close()
+
+	products := store.NewProducts(db.Database("products"))
+	products.Audit.OnError = func(ctx context.Context, err error) {
+		logging.FromContext(ctx).WithField(logging.FieldError, err).Error("write audit entry")
+	}
+	if err := products.EnsureIndexes(appCtx); err != nil {
+		logger.WithField(logging.FieldError, err).Warn("create product indexes")
+	}
+	if err := products.Audit.EnsureIndexes(appCtx); err != nil {
+		logger.WithField(logging.FieldError, err).Warn("create audit indexes")
+	}
 
-	r.GET("/products", func(c *gin.Context) {
-		start := time.Now()
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	categories := store.NewCategories(db.Database("products"), products.Audit)
+	if err := categories.EnsureIndexes(appCtx); err != nil {
+		logger.WithField(logging.FieldError, err).Warn("create category indexes")
+	}
+
+	reservationCfg := loadReservationConfig()
+	stock := inventory.NewStore(db.Database("products"), publisher, products.Audit)
+	if err := stock.EnsureIndexes(appCtx); err != nil {
+		logger.WithField(logging.FieldError, err).Warn("create reservation indexes")
+	}
+	go stock.RunExpiry(appCtx, reservationCfg.ExpiryInterval, logger)
+
+	metrics.RegisterCache("product", productCache.Stats)
+
+	r := gin.New()
+	r.Use(gin.Recovery(), otelgin.Middleware("node-products"), metrics.HTTP(), middleware.Correlation(logger), middleware.AuditSource(), middleware.AccessLog(), middleware.Admin(os.Getenv("ADMIN_TOKEN")))
+	if serverTiming, _ := strconv.ParseBool(os.Getenv("SERVER_TIMING")); serverTiming {
+		r.Use(middleware.ServerTiming())
+	}
+	// promhttp gzips its own output, so /metrics is registered before
+	// Compress to keep it from being encoded twice.
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.Use(middleware.Compress())
+
+	r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "OK"})
+	})
+
+	r.GET("/readyz", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+
+		if err := db.Ping(ctx, readpref.Primary()); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status": "Service Unavailable",
+				"error":  err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "OK"})
+	})
+
+	r.GET("/products", deletedForAdmins, func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
 		defer cancel()
 
 		scheme := "http"
@@ -57,15 +167,36 @@ func main() {
 			}
 			opts.SetProjection(projection)
 		}
+		at, err := priceTime(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
 		// opts.SetProjection(bson.M{
 		// 	"_id":  0,
 		// 	"id":   1,
 		// 	"name": 1,
 		// })
-		products := []Product{}
-		cursor, err := collection.Find(ctx, bson.M{
-			"deleteDate": primitive.Null{},
-		}, &opts)
+		filter := productFilter(c)
+
+		// NDJSON streams every match; the JSON response is one page of
+		// 100 with the total counted separately.
+		ndjson := strings.Contains(c.GetHeader("Accept"), ndjsonContentType)
+		var total int64
+		if !ndjson {
+			if total, err = collection.CountDocuments(ctx, filter); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			opts.SetLimit(100)
+		}
+
+		cursor, err := collection.Find(ctx, filter, &opts)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -75,29 +206,68 @@ func main() {
 
 		defer cursor.Close(ctx)
 
+		if ndjson {
+			streamProducts(ctx, c, cursor, baseURL, at)
+			return
+		}
+
+		products := []catalog.Product{}
 		for cursor.Next(ctx) {
-			var product Product
-			cursor.Decode(&product)
+			var product catalog.Product
+			if err := cursor.Decode(&product); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
 			product.Href = fmt.Sprintf("%s/%s", baseURL, product.ID)
+			product.Price = product.EffectivePrices(at)
+			product.ComputeTotals()
 
 			products = append(products, product)
 		}
+		if err := cursor.Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 
-		durationInMs := time.Since(start).Milliseconds()
 		response := map[string]any{
-			"durations": fmt.Sprintf("%.2f ms", float64(durationInMs)/1000.0),
-			"products":  products[:100],
-			"total":     len(products),
+			"products": products,
+			"total":    total,
 		}
 
 		c.JSON(http.StatusOK, response)
 
 	})
 
-	r.GET("/products/:id", func(c *gin.Context) {
-		start := time.Now()
+	r.GET("/products/export", deletedForAdmins, exportProducts(collection))
+
+	// POST /products/validate checks a product against the same rules the
+	// consumer applies to create.products, without storing it.
+	r.POST("/products/validate", func(c *gin.Context) {
+		var product catalog.Product
+		if err := c.ShouldBindJSON(&product); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err := product.Validate(); err != nil {
+			validationFailed(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product": product,
+		})
+	})
+
+	r.GET("/products/:id", deletedForAdmins, func(c *gin.Context) {
 		id := c.Param("id")
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		lang := c.Query("lang")
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
 		defer cancel()
 
 		scheme := "http"
@@ -107,30 +277,72 @@ func main() {
 
 		baseURL := fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, c.Request.URL.Path)
 
-		product := Product{}
-
-		if err := collection.FindOne(ctx, bson.M{
-			"id":         id,
-			"deleteDate": primitive.Null{},
-		}).Decode(&product); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
+		at, err := priceTime(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
 				"error": err.Error(),
 			})
 			return
 		}
 
+		// Deleted products are never cached, so admins asking for them
+		// always read from Mongo.
+		filter := bson.M{"id": id, "deleteDate": primitive.Null{}}
+		withDeleted := c.Query("includeDeleted") == "true"
+		if withDeleted {
+			delete(filter, "deleteDate")
+		}
+
+		key := productCacheKey{ID: id, Lang: lang}
+		product, ok := productCache.Get(key)
+		if withDeleted || !ok {
+			product = catalog.Product{}
+			if err := collection.FindOne(ctx, filter).Decode(&product); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+
+			if lang != "" {
+				product.SupportingLanguage = filterLanguage(product.SupportingLanguage, lang)
+			}
+			product.ComputeTotals()
+			if product.DeleteDate == nil {
+				productCache.Set(key, product)
+			}
+		}
+
 		product.Href = baseURL
+		product.Price = product.EffectivePrices(at)
 
-		durationInMs := time.Since(start).Milliseconds()
 		response := map[string]any{
-			"durations": fmt.Sprintf("%.2f ms", float64(durationInMs)/1000.0),
-			"product":   product,
+			"product": product,
 		}
 
 		c.JSON(http.StatusOK, response)
 	})
 
-	r.Run(":8080")
+	invalidate := func(id string) {
+		productCache.DeleteFunc(func(k productCacheKey) bool { return k.ID == id })
+	}
+	registerReservations(r, stock, reservationCfg, invalidate)
+	r.POST("/products/:id/status", changeStatus(products, publisher, invalidate))
+	r.GET("/products/:id/history", productHistory(products.Audit))
+	r.POST("/products/:id/restore", restoreProduct(products, publisher, envDuration("PURGE_RETENTION", 30*24*time.Hour)))
+	registerCategories(r, categories, collection, publisher, invalidate)
+
+	if err := serve(r, loadServerConfig()); err != nil {
+		logger.WithField(logging.FieldError, err).Error("HTTP server failed")
+	}
+
+	stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.Disconnect(ctx); err != nil {
+		logger.WithField(logging.FieldError, err).Error("disconnect MongoDB")
+	}
+	logger.Info("HTTP server closed")
 }
 
 type Products struct {
@@ -139,85 +351,157 @@ type Products struct {
 	Href string `json:"href"`
 }
 
-type Price struct {
-	ID                 string                `json:"id,omitempty"`
-	Name               string                `json:"name,omitempty"`
-	Tax                *Tax                  `json:"tax,omitempty"`
-	PopRelationships   []*PopRelationship    `json:"popRelationship,omitempty"`
-	UnitOfMeasure      *UnitOfMeasure        `json:"unitOfMeasure,omitempty"`
-	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty"`
-	Status             string                `json:"status,omitempty"`
-	CreatedAt          string                `json:"createdAt,omitempty"`
-	UpdatedAt          string                `json:"updatedAt,omitempty"`
+// deletedForAdmins rejects ?includeDeleted=true from anyone but an admin.
+func deletedForAdmins(c *gin.Context) {
+	if c.Query("includeDeleted") == "true" && !middleware.IsAdmin(c) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "includeDeleted requires " + middleware.HeaderAdminToken,
+		})
+		return
+	}
+	c.Next()
 }
 
-type Tax struct {
-	Type  string  `json:"type,omitempty"`
-	Value float64 `json:"value,omitempty"`
+// productFilter builds the query shared by the list and export endpoints.
+// Only active products are listed unless ?status= names other statuses,
+// comma separated, or is "all". Deleted products are left out unless an
+// admin passes ?includeDeleted=true.
+func productFilter(c *gin.Context) bson.M {
+	filter := bson.M{
+		"deleteDate": primitive.Null{},
+	}
+	if c.Query("includeDeleted") == "true" && middleware.IsAdmin(c) {
+		delete(filter, "deleteDate")
+	}
+
+	status := c.DefaultQuery("status", string(catalog.StatusActive))
+	if status == "all" {
+		return filter
+	}
+	statuses := bson.A{}
+	for _, s := range strings.Split(status, ",") {
+		statuses = append(statuses, strings.TrimSpace(s))
+		if catalog.Status(strings.TrimSpace(s)) == catalog.StatusActive {
+			statuses = append(statuses, nil)
+		}
+	}
+	filter["status"] = bson.M{"$in": statuses}
+	return filter
 }
 
-type PopRelationship struct {
-	ID   string `json:"id,omitempty"`
-	Name string `json:"name,omitempty"`
+// priceTime is the instant prices are resolved for: ?at= as RFC 3339, or
+// now.
+func priceTime(c *gin.Context) (time.Time, error) {
+	at := c.Query("at")
+	if at == "" {
+		return time.Now(), nil
+	}
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("at must be an RFC 3339 timestamp: %w", err)
+	}
+	return t, nil
 }
 
-type UnitOfMeasure struct {
-	Unit     string  `json:"unit,omitempty"`
-	Amount   float64 `json:"amount,omitempty"`
-	Currency string  `json:"currency,omitempty"`
+// validationFailed responds 422 with the field paths that failed, or 500 if
+// err is not a validation error.
+func validationFailed(c *gin.Context, err error) {
+	var invalid *catalog.ValidationError
+	if !errors.As(err, &invalid) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":  "validation failed",
+		"fields": invalid.Fields,
+	})
 }
 
-type Category struct {
-	ID                 string                `json:"id,omitempty"`
-	Name               string                `json:"name,omitempty"`
-	Description        string                `json:"description,omitempty"`
-	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty"`
-	Status             string                `json:"status,omitempty"`
-	CreatedAt          string                `json:"createdAt,omitempty"`
-	UpdatedAt          string                `json:"updatedAt,omitempty"`
+const ndjsonContentType = "application/x-ndjson"
+
+// streamProducts writes one product per line straight from the cursor so
+// whole catalog exports never hold every document in memory.
+func streamProducts(ctx context.Context, c *gin.Context, cursor *mongo.Cursor, baseURL string, at time.Time) {
+	c.Header("Content-Type", ndjsonContentType)
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	n := 0
+	for cursor.Next(ctx) {
+		var product catalog.Product
+		if err := cursor.Decode(&product); err != nil {
+			logging.FromContext(ctx).WithField(logging.FieldError, err).Error("decode product")
+			continue
+		}
+		product.Href = fmt.Sprintf("%s/%s", baseURL, product.ID)
+		product.Price = product.EffectivePrices(at)
+		product.ComputeTotals()
+
+		if err := enc.Encode(product); err != nil {
+			logging.FromContext(ctx).WithField(logging.FieldError, err).Error("write product")
+			return
+		}
+
+		n++
+		if n%100 == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		logging.FromContext(ctx).WithField(logging.FieldError, err).Error("read products")
+	}
+	c.Writer.Flush()
 }
 
-type SupportingLanguage struct {
-	ID            string         `json:"id,omitempty"`
-	Name          string         `json:"name,omitempty"`
-	Description   string         `json:"description,omitempty"`
-	LanguageCode  string         `json:"languageCode,omitempty"`
-	UnitOfMeasure *UnitOfMeasure `json:"unitOfMeasure,omitempty"`
-	Attachment    []*Attachment  `json:"attachment,omitempty"`
-	Status        string         `json:"status,omitempty"`
-	CreatedAt     string         `json:"createdAt,omitempty"`
-	UpdatedAt     string         `json:"updatedAt,omitempty"`
+type productCacheKey struct {
+	ID   string
+	Lang string
 }
 
-type Attachment struct {
-	ID          string   `json:"id,omitempty"`
-	Name        string   `json:"name,omitempty"`
-	URL         string   `json:"url,omitempty"`
-	Type        string   `json:"type,omitempty"`
-	Status      string   `json:"status,omitempty"`
-	CreatedAt   string   `json:"createdAt,omitempty"`
-	UpdatedAt   string   `json:"updatedAt,omitempty"`
-	Display     *Display `json:"display,omitempty"`
-	RedirectURL string   `json:"redirectUrl,omitempty"`
+func newProductCache() *cache.LRU[productCacheKey, catalog.Product] {
+	size, err := strconv.Atoi(os.Getenv("PRODUCT_CACHE_SIZE"))
+	if err != nil || size <= 0 {
+		size = 10000
+	}
+	ttl, err := time.ParseDuration(os.Getenv("PRODUCT_CACHE_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	return cache.New[productCacheKey, catalog.Product](size, ttl)
 }
 
-type Display struct {
-	Type  string `json:"type,omitempty"`
-	Value string `json:"value,omitempty"`
+// invalidateProduct drops every cached language of the product named in an
+// update/delete event. The id is read from the payload, falling back to the key.
+func invalidateProduct(c *cache.LRU[productCacheKey, catalog.Product]) listener.HandlerFunc {
+	return func(ctx context.Context, topic string, key, value []byte) {
+		var product catalog.Product
+		json.Unmarshal(value, &product)
+		id := product.ID
+		if id == "" {
+			id = string(key)
+		}
+		if id == "" {
+			return
+		}
+
+		n := c.DeleteFunc(func(k productCacheKey) bool { return k.ID == id })
+		logging.FromContext(ctx).WithFields(logrus.Fields{
+			"productId":   id,
+			"invalidated": n,
+		}).Info("product cache invalidated")
+	}
 }
 
-type Product struct {
-	ID                 string                `json:"id,omitempty"`
-	Name               string                `json:"name,omitempty"`
-	Href               string                `json:"href"`
-	Price              []*Price              `json:"price,omitempty"`
-	Category           []*Category           `json:"category,omitempty"`
-	Description        string                `json:"description,omitempty"`
-	Stock              int                   `json:"stock,omitempty"`
-	Status             string                `json:"status,omitempty"`
-	CreatedAt          string                `json:"createdAt,omitempty"`
-	UpdatedAt          string                `json:"updatedAt,omitempty"`
-	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty"`
+func filterLanguage(languages []*catalog.SupportingLanguage, code string) []*catalog.SupportingLanguage {
+	result := []*catalog.SupportingLanguage{}
+	for _, l := range languages {
+		if l != nil && strings.EqualFold(l.LanguageCode, code) {
+			result = append(result, l)
+		}
+	}
+	return result
 }
 
 func ConnectMonoDB() (*mongo.Client, error) {
@@ -229,7 +513,7 @@ func ConnectMonoDB() (*mongo.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(tracing.MongoMonitor(mongometrics.Monitor(prometheus.DefaultRegisterer))))
 	if err != nil {
 		return nil, err
 	}
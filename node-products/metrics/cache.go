@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sing3demons/service-products/cache"
+)
+
+// RegisterCache exports the counters of a cache under cache_*{cache=name}.
+func RegisterCache(name string, stats func() cache.Stats) {
+	labels := prometheus.Labels{"cache": name}
+	counter := func(metric, help string, value func(cache.Stats) uint64) {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "cache",
+			Name:        metric,
+			Help:        help,
+			ConstLabels: labels,
+		}, func() float64 { return float64(value(stats())) })
+	}
+
+	counter("hits_total", "Cache lookups that found a fresh entry.", func(s cache.Stats) uint64 { return s.Hits })
+	counter("misses_total", "Cache lookups that missed or found an expired entry.", func(s cache.Stats) uint64 { return s.Misses })
+	counter("evictions_total", "Entries evicted to stay within the size limit.", func(s cache.Stats) uint64 { return s.Evictions })
+	counter("invalidations_total", "Entries removed by update/delete events.", func(s cache.Stats) uint64 { return s.Invalidations })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   "cache",
+		Name:        "entries",
+		Help:        "Entries currently cached.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(stats().Size) })
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderAdminToken carries the shared secret that unlocks admin-only
+// options such as ?includeDeleted=true.
+const HeaderAdminToken = "X-Admin-Token"
+
+const adminKey = "admin"
+
+// Admin marks the request as coming from an administrator when it carries
+// token in HeaderAdminToken. An empty token disables admin access.
+func Admin(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given := c.GetHeader(HeaderAdminToken)
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			c.Set(adminKey, true)
+		}
+		c.Next()
+	}
+}
+
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool(adminKey)
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/logging"
+)
+
+// HeaderUser names the caller in audit entries. It is set by the gateway
+// after authentication; node-products does not check it.
+const HeaderUser = "X-User-Id"
+
+// AuditSource marks writes made by this request as coming over HTTP from
+// the caller in HeaderUser. It must run after Correlation.
+func AuditSource() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		ctx = store.WithSource(ctx, store.Source{
+			Kind:          "http",
+			Method:        c.Request.Method,
+			Path:          c.Request.URL.Path,
+			User:          c.GetHeader(HeaderUser),
+			CorrelationID: logging.CorrelationID(ctx),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
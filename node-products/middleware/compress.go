@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter starts the encoder on the first body byte, so responses
+// that never write one (204, 304, an empty 200) go out without a
+// Content-Encoding header or an empty compressed stream.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	encoder  flushWriter
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.encoder == nil {
+		if len(b) == 0 || !bodyAllowed(w.Status()) {
+			return w.ResponseWriter.Write(b)
+		}
+		w.start()
+	}
+	return w.encoder.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush pushes buffered compressed bytes to the client, which keeps
+// streamed responses moving instead of waiting for the encoder to fill up.
+func (w *compressWriter) Flush() {
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// start sets the encoding headers, which gin has not sent yet because
+// nothing was written, and wraps the underlying writer.
+func (w *compressWriter) start() {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Encoding", w.encoding)
+	switch w.encoding {
+	case "br":
+		w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+	case "gzip":
+		w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, gzip.DefaultCompression)
+	}
+}
+
+func (w *compressWriter) close() {
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
+
+// bodyAllowed reports whether a response with status may carry a body.
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// Compress encodes responses with brotli or gzip, whichever the client
+// prefers in Accept-Encoding. Clients that send neither get plain bodies,
+// as do HEAD requests and responses without a body.
+func Compress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiate(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Accept-Encoding")
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = writer
+		defer writer.close()
+
+		c.Next()
+	}
+}
+
+// negotiate picks the supported encoding with the highest q value,
+// preferring brotli on ties.
+func negotiate(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "br" && name != "gzip" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// Correlation tags the request with the caller's correlation id, or a new
+// one, echoes it in the response and stores a log entry carrying it in the
+// request context.
+func Correlation(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := logging.FromHTTP(c.Request.Header)
+		c.Header(logging.HeaderCorrelationID, id)
+
+		ctx, _ := logging.NewContext(c.Request.Context(), logger, id)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// AccessLog writes one structured line per request in place of gin's
+// default text logger. It must run after Correlation.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		entry := logging.FromContext(c.Request.Context()).WithFields(logrus.Fields{
+			logging.FieldMethod:     c.Request.Method,
+			logging.FieldPath:       c.Request.URL.Path,
+			logging.FieldRoute:      c.FullPath(),
+			logging.FieldStatus:     status,
+			logging.FieldDurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			"query":                 c.Request.URL.RawQuery,
+			"bytes":                 c.Writer.Size(),
+			"clientIp":              c.ClientIP(),
+			"userAgent":             c.Request.UserAgent(),
+		})
+		if len(c.Errors) > 0 {
+			entry = entry.WithField(logging.FieldError, c.Errors.String())
+		}
+
+		switch {
+		case status >= 500:
+			entry.Error("request")
+		case status >= 400:
+			entry.Warn("request")
+		default:
+			entry.Info("request")
+		}
+	}
+}
+
+type timingWriter struct {
+	gin.ResponseWriter
+	start   time.Time
+	written bool
+}
+
+func (w *timingWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timingWriter) setHeader() {
+	if w.written || w.ResponseWriter.Written() {
+		return
+	}
+	w.written = true
+	ms := float64(time.Since(w.start).Microseconds()) / 1000
+	w.Header().Set("Server-Timing", fmt.Sprintf("app;dur=%.2f", ms))
+}
+
+// ServerTiming reports the time spent before the response headers were
+// sent in a Server-Timing header, which browsers show in their dev tools.
+func ServerTiming() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &timingWriter{ResponseWriter: c.Writer, start: time.Now()}
+		c.Next()
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/service-products/inventory"
+)
+
+type reserveRequest struct {
+	Quantity int `json:"quantity"`
+	// TTLSeconds overrides RESERVATION_TTL, up to RESERVATION_MAX_TTL.
+	TTLSeconds int `json:"ttlSeconds"`
+}
+
+type reservationConfig struct {
+	TTL            time.Duration
+	MaxTTL         time.Duration
+	ExpiryInterval time.Duration
+}
+
+func loadReservationConfig() reservationConfig {
+	return reservationConfig{
+		TTL:            envDuration("RESERVATION_TTL", 15*time.Minute),
+		MaxTTL:         envDuration("RESERVATION_MAX_TTL", 24*time.Hour),
+		ExpiryInterval: envDuration("RESERVATION_EXPIRY_INTERVAL", 30*time.Second),
+	}
+}
+
+// registerReservations mounts the stock reservation endpoints. On success
+// each one drops the product from the local cache so the next read shows
+// the new stock; other instances drop it when the stock event arrives.
+func registerReservations(r *gin.Engine, store *inventory.Store, cfg reservationConfig, invalidate func(id string)) {
+	r.POST("/products/:id/reservations", func(c *gin.Context) {
+		var req reserveRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if req.Quantity <= 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "validation failed",
+				"fields": []gin.H{{"field": "quantity", "message": "must be positive"}},
+			})
+			return
+		}
+		ttl := cfg.TTL
+		if req.TTLSeconds > 0 {
+			ttl = min(time.Duration(req.TTLSeconds)*time.Second, cfg.MaxTTL)
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		reservation, err := store.Reserve(ctx, c.Param("id"), req.Quantity, ttl)
+		if err != nil {
+			reservationFailed(c, err)
+			return
+		}
+		invalidate(reservation.ProductID)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"reservation": reservation,
+		})
+	})
+
+	r.POST("/reservations/:id/commit", reservationAction(store.Commit, invalidate))
+	r.POST("/reservations/:id/release", reservationAction(store.Release, invalidate))
+}
+
+func reservationAction(action func(context.Context, string) (*inventory.Reservation, error), invalidate func(id string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		reservation, err := action(ctx, c.Param("id"))
+		if err != nil {
+			reservationFailed(c, err)
+			return
+		}
+		invalidate(reservation.ProductID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"reservation": reservation,
+		})
+	}
+}
+
+func reservationFailed(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, inventory.ErrProductNotFound), errors.Is(err, inventory.ErrReservationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, inventory.ErrInsufficientStock), errors.Is(err, inventory.ErrNotAvailable), errors.Is(err, inventory.ErrNotReserved):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
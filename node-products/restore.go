@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/service-products/events"
+)
+
+// restoreProduct handles POST /products/:id/restore. retention must match
+// the consumer's purge.retention so a product is restorable until the
+// purge job could remove it.
+func restoreProduct(products *store.Products, publisher events.Publisher, retention time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		product, err := products.Restore(ctx, c.Param("id"), retention)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, store.ErrNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, store.ErrRetentionExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := publisher.Publish(ctx, "update.products", product.ID, product); err != nil {
+			logging.FromContext(ctx).WithField(logging.FieldError, err).Error("publish update.products")
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product": product,
+		})
+	}
+}
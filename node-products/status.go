@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sing3demons/catalog"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/service-products/events"
+)
+
+// statusRequest is the body of the status endpoints. PriceID narrows a
+// product change to one of its prices.
+type statusRequest struct {
+	Status  catalog.Status `json:"status"`
+	Reason  string         `json:"reason"`
+	PriceID string         `json:"priceId"`
+}
+
+// changeStatus handles POST /products/:id/status. The updated product is
+// published to update.products so every instance drops its cached copy.
+func changeStatus(products *store.Products, publisher events.Publisher, invalidate func(id string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindStatus(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		change := catalog.StatusChange{
+			To:     req.Status,
+			Reason: req.Reason,
+			Source: "http",
+		}
+		var product *catalog.Product
+		var err error
+		if req.PriceID != "" {
+			product, err = products.TransitionPrice(ctx, c.Param("id"), req.PriceID, change)
+		} else {
+			product, err = products.Transition(ctx, c.Param("id"), change)
+		}
+		if !statusOK(c, err) {
+			return
+		}
+
+		invalidate(product.ID)
+		if err := publisher.Publish(ctx, "update.products", product.ID, product); err != nil {
+			logging.FromContext(ctx).WithField(logging.FieldError, err).Error("publish update.products")
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"product": product,
+		})
+	}
+}
+
+// changeCategoryStatus handles POST /categories/:id/status. Every product
+// that lists the category is published to update.products, since each
+// embeds a snapshot of it.
+func changeCategoryStatus(categories *store.Categories, publisher events.Publisher, invalidate func(id string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindStatus(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		category, ids, err := categories.Transition(ctx, c.Param("id"), catalog.StatusChange{
+			To:     req.Status,
+			Reason: req.Reason,
+			Source: "http",
+		})
+		if !statusOK(c, err) {
+			return
+		}
+
+		for _, id := range ids {
+			invalidate(id)
+			if err := publisher.Publish(ctx, "update.products", id, gin.H{"id": id}); err != nil {
+				logging.FromContext(ctx).WithField(logging.FieldError, err).Error("publish update.products")
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"category": category,
+		})
+	}
+}
+
+func bindStatus(c *gin.Context) (statusRequest, bool) {
+	var req statusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return req, false
+	}
+	if !req.Status.Valid() {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "validation failed",
+			"fields": []catalog.FieldError{{Field: "status", Message: "unknown status " + string(req.Status)}},
+		})
+		return req, false
+	}
+	return req, true
+}
+
+// statusOK writes the response for a failed transition and reports whether
+// there was none.
+func statusOK(c *gin.Context, err error) bool {
+	var illegal *catalog.TransitionError
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrPriceNotFound), errors.Is(err, store.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return false
+	case errors.As(err, &illegal), errors.Is(err, store.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
@@ -62,9 +62,9 @@ async function createProducts() {
     const price: Price = {
       id: generateId(),
       unitOfMeasure: {
-        unit: 'THB',
+        unit: 'piece',
         amount: Math.random() * 1000,
-        currency: '฿',
+        currency: 'THB',
       },
       createdAt: new Date(),
       updatedAt: new Date(),
@@ -173,9 +173,9 @@ async function createProduct() {
     const price: Price = {
       id: generateId(),
       unitOfMeasure: {
-        unit: 'THB',
+        unit: 'piece',
         amount: Math.random() * 1000,
-        currency: '฿',
+        currency: 'THB',
       },
       createdAt: new Date(),
       updatedAt: new Date(),
@@ -0,0 +1,206 @@
+// Package produce publishes Kafka events from node-products and
+// service_consumer with the headers node-service puts on its own.
+package produce
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/tracing"
+	logrus "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Header names shared with node-service so consumers see the same keys
+// whichever service produced the message.
+const (
+	HeaderCorrelationID    = "x-correlation-id"
+	HeaderMessageType      = "x-message-type"
+	HeaderMessageVersion   = "x-message-version"
+	HeaderMessageTimestamp = "x-message-timestamp"
+	HeaderSystemID         = "system-id"
+)
+
+// Event is a message to publish. Key should be the product id so every
+// event for one product lands on the same partition and stays ordered.
+// A nil Body is sent as a tombstone with no value.
+type Event struct {
+	Key     string
+	Type    string
+	Version string
+	Headers map[string]string
+	Body    any
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, topic string, event Event) error
+	Close() error
+}
+
+// NewConfig returns an idempotent producer configuration: acks from all
+// in-sync replicas, a single in-flight request and key hash partitioning.
+func NewConfig(systemID string) *sarama.Config {
+	config := sarama.NewConfig()
+	config.ClientID = systemID
+	config.Version = sarama.V1_0_0_0
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Retry.Backoff = 100 * time.Millisecond
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Producer.Compression = sarama.CompressionGZIP
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Net.MaxOpenRequests = 1
+	return config
+}
+
+// NewMessage encodes event as JSON and attaches the standard headers.
+func NewMessage(ctx context.Context, systemID, topic string, event Event) (*sarama.ProducerMessage, error) {
+	var value sarama.Encoder
+	if event.Body != nil {
+		body, err := json.Marshal(event.Body)
+		if err != nil {
+			return nil, err
+		}
+		value = sarama.ByteEncoder(body)
+	}
+
+	version := event.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+
+	headers := map[string]string{}
+	for k, v := range event.Headers {
+		headers[k] = v
+	}
+	headers[HeaderMessageType] = event.Type
+	headers[HeaderMessageVersion] = version
+	headers[HeaderMessageTimestamp] = time.Now().UTC().Format(time.RFC3339)
+	headers[HeaderSystemID] = systemID
+	if id := logging.CorrelationID(ctx); id != "" {
+		headers[HeaderCorrelationID] = id
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: value,
+	}
+	if event.Key != "" {
+		msg.Key = sarama.StringEncoder(event.Key)
+	}
+	for k, v := range headers {
+		if v != "" {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+		}
+	}
+
+	return msg, nil
+}
+
+// SyncProducer blocks until each message is acknowledged.
+type SyncProducer struct {
+	producer sarama.SyncProducer
+	systemID string
+}
+
+// NewSyncProducer connects with config, usually built by NewConfig. Its
+// ClientID is sent as the system-id header.
+func NewSyncProducer(brokers []string, config *sarama.Config) (*SyncProducer, error) {
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncProducer{producer: producer, systemID: config.ClientID}, nil
+}
+
+func (p *SyncProducer) Publish(ctx context.Context, topic string, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msg, err := NewMessage(ctx, p.systemID, topic, event)
+	if err != nil {
+		return err
+	}
+
+	_, span := tracing.StartProduce(ctx, msg)
+	defer span.End()
+
+	if _, _, err = p.producer.SendMessage(msg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func (p *SyncProducer) Close() error {
+	return p.producer.Close()
+}
+
+// AsyncProducer queues messages and reports delivery failures to the logger.
+type AsyncProducer struct {
+	producer sarama.AsyncProducer
+	systemID string
+	done     chan struct{}
+}
+
+func NewAsyncProducer(brokers []string, config *sarama.Config, logger *logrus.Logger) (*AsyncProducer, error) {
+	producer, err := sarama.NewAsyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &AsyncProducer{producer: producer, systemID: config.ClientID, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		successes, errors := producer.Successes(), producer.Errors()
+		for successes != nil || errors != nil {
+			select {
+			case _, ok := <-successes:
+				if !ok {
+					successes = nil
+				}
+			case err, ok := <-errors:
+				if !ok {
+					errors = nil
+					continue
+				}
+				logger.WithFields(logrus.Fields{
+					"topic": err.Msg.Topic,
+					"error": err.Err,
+				}).Error("publish failed")
+			}
+		}
+	}()
+
+	return p, nil
+}
+
+func (p *AsyncProducer) Publish(ctx context.Context, topic string, event Event) error {
+	msg, err := NewMessage(ctx, p.systemID, topic, event)
+	if err != nil {
+		return err
+	}
+
+	_, span := tracing.StartProduce(ctx, msg)
+	defer span.End()
+
+	select {
+	case p.producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes queued messages and waits for their results.
+func (p *AsyncProducer) Close() error {
+	err := p.producer.Close()
+	<-p.done
+	return err
+}
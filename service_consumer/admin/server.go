@@ -0,0 +1,157 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// HeaderAdminToken carries the shared secret that unlocks requests which
+// change state, matching the header node-products uses.
+const HeaderAdminToken = "X-Admin-Token"
+
+// Check reports a problem by returning an error.
+type Check func(ctx context.Context) error
+
+// Server is the consumer's admin HTTP surface. It serves the probe endpoints
+// and anything else registered with Handle. Every request other than GET and
+// HEAD must carry the admin token.
+type Server struct {
+	srv    *http.Server
+	mux    *http.ServeMux
+	token  string
+	logger *logrus.Logger
+
+	mu        sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+// NewServer returns a server listening on addr. An empty token refuses every
+// request that changes state, such as pausing consumption.
+func NewServer(addr, token string, logger *logrus.Logger) *Server {
+	s := &Server{
+		mux:       http.NewServeMux(),
+		token:     token,
+		logger:    logger,
+		liveness:  map[string]Check{},
+		readiness: map[string]Check{},
+	}
+	s.srv = &http.Server{
+		Addr:              addr,
+		Handler:           s.authorize(s.mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	s.mux.HandleFunc("/livez", s.probe(func() map[string]Check { return s.liveness }))
+	s.mux.HandleFunc("/readyz", s.probe(func() map[string]Check { return s.readiness }))
+	s.mux.HandleFunc("/healthz", s.probe(func() map[string]Check {
+		all := map[string]Check{}
+		for name, check := range s.liveness {
+			all[name] = check
+		}
+		for name, check := range s.readiness {
+			all[name] = check
+		}
+		return all
+	}))
+
+	return s
+}
+
+// AddLivenessCheck registers a check that fails /livez, after which the
+// process should be restarted.
+func (s *Server) AddLivenessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.liveness[name] = check
+}
+
+// AddReadinessCheck registers a check that fails /readyz while the consumer
+// cannot process messages.
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readiness[name] = check
+}
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Start serves in the background until Shutdown is called.
+func (s *Server) Start() {
+	go func() {
+		s.logger.WithField("addr", s.srv.Addr).Info("Admin server listening")
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.WithField("error", err).Error("Admin server stopped")
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// authorize lets safe methods through and requires the admin token for
+// everything else.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.token == "" {
+			WriteJSON(w, http.StatusForbidden, map[string]string{"error": "admin token is not configured"})
+			return
+		}
+		given := r.Header.Get(HeaderAdminToken)
+		if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+			WriteJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid " + HeaderAdminToken})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) probe(checks func() map[string]Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		s.mu.RLock()
+		results := map[string]string{}
+		status := http.StatusOK
+		for name, check := range checks() {
+			if err := check(ctx); err != nil {
+				results[name] = err.Error()
+				status = http.StatusServiceUnavailable
+			} else {
+				results[name] = "ok"
+			}
+		}
+		s.mu.RUnlock()
+
+		WriteJSON(w, status, map[string]any{
+			"status": http.StatusText(status),
+			"checks": results,
+		})
+	}
+}
+
+// WriteJSON writes v as the response body with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
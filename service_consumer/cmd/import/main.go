@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/produce"
+	"github.com/sing3demons/service-consumer/importer"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	productTopic  = "create.products"
+	languageTopic = "create.productsLanguage"
+)
+
+var logger *logrus.Logger
+
+func init() {
+	godotenv.Load(".env")
+	logger = logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetOutput(os.Stdout)
+	logger.SetLevel(logrus.InfoLevel)
+}
+
+// Import products from a CSV or NDJSON file:
+//
+//	go run ./cmd/import -file products.csv
+//	go run ./cmd/import -file products.ndjson -dry-run
+func main() {
+	file := flag.String("file", "", "path to a .csv or .ndjson file, - for stdin")
+	format := flag.String("format", "", "csv or ndjson, defaults to the file extension")
+	dryRun := flag.Bool("dry-run", false, "validate only, do not publish")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var brokers []string
+	for _, broker := range strings.Split(os.Getenv("KAFKA_BROKERS"), ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 && !*dryRun {
+		logger.Fatal("KAFKA_BROKERS is required unless -dry-run is set")
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	}
+
+	var input io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			logger.Fatalf("open %s: %v", *file, err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	var records []*importer.Record
+	var rowErrors []importer.RowError
+	switch *format {
+	case "csv":
+		records, rowErrors = importer.ParseCSV(input)
+	case "ndjson", "jsonl":
+		records, rowErrors = importer.ParseNDJSON(input)
+	default:
+		logger.Fatalf("unsupported format %q, expected csv or ndjson", *format)
+	}
+
+	now := time.Now()
+	valid := records[:0]
+	for _, record := range records {
+		if err := record.Validate(now); err != nil {
+			rowErrors = append(rowErrors, importer.RowError{Line: record.Line, Err: err})
+			continue
+		}
+		valid = append(valid, record)
+	}
+
+	sort.Slice(rowErrors, func(i, j int) bool { return rowErrors[i].Line < rowErrors[j].Line })
+	for _, rowError := range rowErrors {
+		logger.WithFields(logrus.Fields{
+			"line":  rowError.Line,
+			"error": rowError.Err.Error(),
+		}).Warn("row rejected")
+	}
+
+	published := 0
+	failed := false
+	if !*dryRun && len(valid) > 0 {
+		var err error
+		published, err = publish(brokers, valid)
+		if err != nil {
+			logger.WithField("error", err).Error("publish failed")
+		}
+		failed = err != nil || published < len(valid)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"file":      *file,
+		"format":    *format,
+		"valid":     len(valid),
+		"rejected":  len(rowErrors),
+		"published": published,
+		"dryRun":    *dryRun,
+	}).Info("import finished")
+
+	// A partial publish or any rejected row fails the run so cron and CI
+	// notice.
+	if failed || len(rowErrors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// publish sends languages before their products so the consumer has every
+// language row by the time the product referencing it is stored.
+func publish(brokers []string, records []*importer.Record) (int, error) {
+	producer, err := produce.NewSyncProducer(brokers, produce.NewConfig("product-import"))
+	if err != nil {
+		return 0, err
+	}
+	defer producer.Close()
+
+	ctx, entry := logging.NewContext(context.Background(), logger, logging.NewID())
+	entry.WithField("records", len(records)).Info("publishing import")
+	published := 0
+	for _, record := range records {
+		for _, language := range record.Languages {
+			if err := producer.Publish(ctx, languageTopic, produce.Event{
+				Key:  record.Product.ID,
+				Type: "create",
+				Body: language,
+			}); err != nil {
+				return published, err
+			}
+		}
+
+		if err := producer.Publish(ctx, productTopic, produce.Event{
+			Key:  record.Product.ID,
+			Type: "create",
+			Body: record.Product,
+		}); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	return published, nil
+}
@@ -0,0 +1,398 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sing3demons/produce"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Kafka   KafkaConfig `yaml:"kafka"`
+	Mongo   MongoConfig `yaml:"mongo"`
+	Admin   AdminConfig `yaml:"admin"`
+	Purge   PurgeConfig `yaml:"purge"`
+	Verbose bool        `yaml:"verbose"`
+	// ShutdownTimeout bounds draining the consumer and closing connections.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+type AdminConfig struct {
+	Addr string `yaml:"addr"`
+	// Token must be sent in X-Admin-Token with every admin request that
+	// changes state. Without one those requests are refused.
+	Token string `yaml:"token"`
+}
+
+// PurgeConfig controls the job that hard-deletes soft-deleted products. It
+// is off unless enabled.
+type PurgeConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Retention is how long a product stays restorable after deleteDate.
+	Retention time.Duration `yaml:"retention"`
+	Interval  time.Duration `yaml:"interval"`
+	// BatchSize caps the products purged per run.
+	BatchSize int `yaml:"batchSize"`
+	// TombstoneTopic receives a null-valued message keyed by each purged
+	// product id. It must not be one of the topics this service consumes.
+	TombstoneTopic string `yaml:"tombstoneTopic"`
+}
+
+type KafkaConfig struct {
+	Brokers            []string      `yaml:"brokers"`
+	Topics             []string      `yaml:"topics"`
+	Group              string        `yaml:"group"`
+	Assignor           string        `yaml:"assignor"`
+	Oldest             bool          `yaml:"oldest"`
+	Version            string        `yaml:"version"`
+	ClientID           string        `yaml:"clientId"`
+	SessionTimeout     time.Duration `yaml:"sessionTimeout"`
+	HeartbeatInterval  time.Duration `yaml:"heartbeatInterval"`
+	RebalanceTimeout   time.Duration `yaml:"rebalanceTimeout"`
+	MaxProcessingTime  time.Duration `yaml:"maxProcessingTime"`
+	AutoCommitInterval time.Duration `yaml:"autoCommitInterval"`
+	FetchMinBytes      int32         `yaml:"fetchMinBytes"`
+	FetchDefaultBytes  int32         `yaml:"fetchDefaultBytes"`
+	ChannelBufferSize  int           `yaml:"channelBufferSize"`
+}
+
+type MongoConfig struct {
+	URL            string        `yaml:"url"`
+	Database       string        `yaml:"database"`
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`
+	Timeout        time.Duration `yaml:"timeout"`
+	MaxPoolSize    uint64        `yaml:"maxPoolSize"`
+	MinPoolSize    uint64        `yaml:"minPoolSize"`
+}
+
+// Default mirrors the values that used to be hardcoded in main.go.
+func Default() *Config {
+	return &Config{
+		Kafka: KafkaConfig{
+			Group:              "kafka-for-dev",
+			Assignor:           "sticky",
+			Oldest:             true,
+			Version:            "1.0.0",
+			ClientID:           "service-consumer",
+			SessionTimeout:     10 * time.Second,
+			HeartbeatInterval:  3 * time.Second,
+			RebalanceTimeout:   60 * time.Second,
+			MaxProcessingTime:  100 * time.Millisecond,
+			AutoCommitInterval: time.Second,
+			FetchMinBytes:      1,
+			FetchDefaultBytes:  1024 * 1024,
+			ChannelBufferSize:  256,
+		},
+		Mongo: MongoConfig{
+			Database:       "products",
+			ConnectTimeout: 10 * time.Second,
+			Timeout:        15 * time.Second,
+			MaxPoolSize:    100,
+		},
+		Admin: AdminConfig{
+			Addr: ":8081",
+		},
+		Purge: PurgeConfig{
+			Retention:      30 * 24 * time.Hour,
+			Interval:       time.Hour,
+			BatchSize:      500,
+			TombstoneTopic: "purged.products",
+		},
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// Load builds the configuration from, in increasing priority, the defaults,
+// the YAML file named by -config or CONFIG_FILE, environment variables and
+// command line flags.
+func Load(args []string) (*Config, error) {
+	path := configPath(args)
+
+	cfg := Default()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.String("config", path, "path to a YAML config file")
+	brokers := fs.String("brokers", strings.Join(cfg.Kafka.Brokers, ","), "Kafka brokers, comma separated")
+	topics := fs.String("topics", strings.Join(cfg.Kafka.Topics, ","), "Kafka topics, comma separated")
+	fs.StringVar(&cfg.Kafka.Group, "group", cfg.Kafka.Group, "Kafka consumer group")
+	fs.StringVar(&cfg.Kafka.Assignor, "assignor", cfg.Kafka.Assignor, "partition assignor: sticky, roundrobin or range")
+	fs.BoolVar(&cfg.Kafka.Oldest, "oldest", cfg.Kafka.Oldest, "start from the oldest offset when the group has none")
+	fs.StringVar(&cfg.Kafka.Version, "version", cfg.Kafka.Version, "Kafka cluster version")
+	fs.StringVar(&cfg.Mongo.URL, "mongo-url", cfg.Mongo.URL, "MongoDB connection string")
+	fs.StringVar(&cfg.Mongo.Database, "mongo-database", cfg.Mongo.Database, "MongoDB database")
+	fs.StringVar(&cfg.Admin.Addr, "admin-addr", cfg.Admin.Addr, "admin HTTP server address")
+	fs.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "log sarama internals")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.Kafka.Brokers = splitList(*brokers)
+	cfg.Kafka.Topics = splitList(*topics)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	list := func(name string, dst *[]string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = splitList(v)
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			*dst = b
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			*dst = d
+		}
+	}
+	integer := func(name string, bits int, set func(int64)) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.ParseInt(v, 10, bits)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			set(n)
+		}
+	}
+
+	list("KAFKA_BROKERS", &cfg.Kafka.Brokers)
+	list("KAFKA_TOPICS", &cfg.Kafka.Topics)
+	str("KAFKA_GROUP", &cfg.Kafka.Group)
+	str("KAFKA_ASSIGNOR", &cfg.Kafka.Assignor)
+	boolean("KAFKA_OLDEST", &cfg.Kafka.Oldest)
+	str("KAFKA_VERSION", &cfg.Kafka.Version)
+	str("KAFKA_CLIENT_ID", &cfg.Kafka.ClientID)
+	duration("KAFKA_SESSION_TIMEOUT", &cfg.Kafka.SessionTimeout)
+	duration("KAFKA_HEARTBEAT_INTERVAL", &cfg.Kafka.HeartbeatInterval)
+	duration("KAFKA_REBALANCE_TIMEOUT", &cfg.Kafka.RebalanceTimeout)
+	duration("KAFKA_MAX_PROCESSING_TIME", &cfg.Kafka.MaxProcessingTime)
+	duration("KAFKA_AUTO_COMMIT_INTERVAL", &cfg.Kafka.AutoCommitInterval)
+	integer("KAFKA_FETCH_MIN_BYTES", 32, func(n int64) { cfg.Kafka.FetchMinBytes = int32(n) })
+	integer("KAFKA_FETCH_DEFAULT_BYTES", 32, func(n int64) { cfg.Kafka.FetchDefaultBytes = int32(n) })
+	integer("KAFKA_CHANNEL_BUFFER_SIZE", 32, func(n int64) { cfg.Kafka.ChannelBufferSize = int(n) })
+	boolean("KAFKA_VERBOSE", &cfg.Verbose)
+	str("ADMIN_ADDR", &cfg.Admin.Addr)
+	str("ADMIN_TOKEN", &cfg.Admin.Token)
+	duration("SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	boolean("PURGE_ENABLED", &cfg.Purge.Enabled)
+	duration("PURGE_RETENTION", &cfg.Purge.Retention)
+	duration("PURGE_INTERVAL", &cfg.Purge.Interval)
+	integer("PURGE_BATCH_SIZE", 32, func(n int64) { cfg.Purge.BatchSize = int(n) })
+	str("PURGE_TOMBSTONE_TOPIC", &cfg.Purge.TombstoneTopic)
+	str("MONGO_URL", &cfg.Mongo.URL)
+	str("MONGO_DATABASE", &cfg.Mongo.Database)
+	duration("MONGO_CONNECT_TIMEOUT", &cfg.Mongo.ConnectTimeout)
+	duration("MONGO_TIMEOUT", &cfg.Mongo.Timeout)
+	integer("MONGO_MAX_POOL_SIZE", 64, func(n int64) { cfg.Mongo.MaxPoolSize = uint64(n) })
+	integer("MONGO_MIN_POOL_SIZE", 64, func(n int64) { cfg.Mongo.MinPoolSize = uint64(n) })
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once so a bad deployment fails
+// at startup with the full list.
+func (cfg *Config) Validate() error {
+	var errs []error
+	k := cfg.Kafka
+	if len(k.Brokers) == 0 {
+		errs = append(errs, errors.New("kafka.brokers is required"))
+	}
+	if len(k.Topics) == 0 {
+		errs = append(errs, errors.New("kafka.topics is required"))
+	}
+	if k.Group == "" {
+		errs = append(errs, errors.New("kafka.group is required"))
+	}
+	if _, err := balanceStrategy(k.Assignor); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := sarama.ParseKafkaVersion(k.Version); err != nil {
+		errs = append(errs, fmt.Errorf("kafka.version: %w", err))
+	}
+	if k.HeartbeatInterval <= 0 || k.SessionTimeout <= 0 || k.HeartbeatInterval >= k.SessionTimeout {
+		errs = append(errs, errors.New("kafka.heartbeatInterval must be positive and lower than kafka.sessionTimeout"))
+	}
+	if k.RebalanceTimeout <= 0 || k.MaxProcessingTime <= 0 || k.AutoCommitInterval <= 0 {
+		errs = append(errs, errors.New("kafka timeouts and intervals must be positive"))
+	}
+	if k.FetchMinBytes <= 0 || k.FetchDefaultBytes <= 0 || k.ChannelBufferSize < 0 {
+		errs = append(errs, errors.New("kafka fetch sizes must be positive"))
+	}
+
+	m := cfg.Mongo
+	if m.URL == "" {
+		errs = append(errs, errors.New("mongo.url is required"))
+	}
+	if m.Database == "" {
+		errs = append(errs, errors.New("mongo.database is required"))
+	}
+	if m.ConnectTimeout <= 0 || m.Timeout <= 0 {
+		errs = append(errs, errors.New("mongo timeouts must be positive"))
+	}
+	if m.MaxPoolSize != 0 && m.MinPoolSize > m.MaxPoolSize {
+		errs = append(errs, errors.New("mongo.minPoolSize must not exceed mongo.maxPoolSize"))
+	}
+
+	if p := cfg.Purge; p.Enabled {
+		if p.Retention <= 0 || p.Interval <= 0 || p.BatchSize <= 0 {
+			errs = append(errs, errors.New("purge retention, interval and batchSize must be positive"))
+		}
+		if p.TombstoneTopic == "" {
+			errs = append(errs, errors.New("purge.tombstoneTopic is required"))
+		}
+		for _, topic := range k.Topics {
+			if topic == p.TombstoneTopic {
+				errs = append(errs, fmt.Errorf("purge.tombstoneTopic %q must not be a consumed topic", topic))
+			}
+		}
+	}
+
+	if cfg.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdownTimeout must be positive"))
+	}
+	if cfg.Admin.Addr == "" {
+		errs = append(errs, errors.New("admin.addr is required"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Sarama converts the Kafka settings into a consumer group configuration.
+func (k KafkaConfig) Sarama() (*sarama.Config, error) {
+	version, err := sarama.ParseKafkaVersion(k.Version)
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := balanceStrategy(k.Assignor)
+	if err != nil {
+		return nil, err
+	}
+
+	config := sarama.NewConfig()
+	config.Version = version
+	config.ClientID = k.ClientID
+	config.ChannelBufferSize = k.ChannelBufferSize
+	config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{strategy}
+	config.Consumer.Group.Session.Timeout = k.SessionTimeout
+	config.Consumer.Group.Heartbeat.Interval = k.HeartbeatInterval
+	config.Consumer.Group.Rebalance.Timeout = k.RebalanceTimeout
+	config.Consumer.MaxProcessingTime = k.MaxProcessingTime
+	config.Consumer.Offsets.AutoCommit.Interval = k.AutoCommitInterval
+	config.Consumer.Fetch.Min = k.FetchMinBytes
+	config.Consumer.Fetch.Default = k.FetchDefaultBytes
+	if k.Oldest {
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+
+	return config, nil
+}
+
+// Producer converts the Kafka settings into an idempotent producer
+// configuration, so producers share the cluster version and client id.
+func (k KafkaConfig) Producer() (*sarama.Config, error) {
+	version, err := sarama.ParseKafkaVersion(k.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	config := produce.NewConfig(k.ClientID)
+	config.Version = version
+	config.ChannelBufferSize = k.ChannelBufferSize
+	return config, nil
+}
+
+// ClientOptions converts the Mongo settings into driver options.
+func (m MongoConfig) ClientOptions() *options.ClientOptions {
+	opts := options.Client().
+		ApplyURI(m.URL).
+		SetConnectTimeout(m.ConnectTimeout).
+		SetTimeout(m.Timeout)
+	if m.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(m.MaxPoolSize)
+	}
+	if m.MinPoolSize > 0 {
+		opts.SetMinPoolSize(m.MinPoolSize)
+	}
+	return opts
+}
+
+func balanceStrategy(assignor string) (sarama.BalanceStrategy, error) {
+	switch assignor {
+	case "sticky":
+		return sarama.NewBalanceStrategySticky(), nil
+	case "roundrobin":
+		return sarama.NewBalanceStrategyRoundRobin(), nil
+	case "range":
+		return sarama.NewBalanceStrategyRange(), nil
+	default:
+		return nil, fmt.Errorf("unrecognized consumer group partition assignor: %q", assignor)
+	}
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// configPath finds -config before the other flags are parsed, because the
+// file it names supplies their defaults.
+func configPath(args []string) string {
+	path := os.Getenv("CONFIG_FILE")
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			path = value
+		} else if i+1 < len(args) {
+			path = args[i+1]
+		}
+	}
+	return path
+}
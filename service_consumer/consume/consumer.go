@@ -1,131 +1,397 @@
 package consume
 
 import (
-	"github.com/sing3demons/service-consumer/database"
-
 	"context"
 	"errors"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/tracing"
 	logrus "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
 )
 
-type consumerHandler struct {
-	db     database.IMongo
-	logger *logrus.Logger
+// Handler processes one message. Its context carries the message's trace
+// span and a log entry tagged with the correlation id, and is not cancelled
+// by rebalances, so a handler always finishes what it started. A message is
+// committed once Handle returns nil or a *RejectError; any other error is
+// retried with backoff.
+type Handler interface {
+	Handle(ctx context.Context, msg *sarama.ConsumerMessage) error
 }
 
-func NewConsumerHandler(db database.IMongo, logger *logrus.Logger) sarama.ConsumerGroupHandler {
-	return consumerHandler{db: db, logger: logger}
+// RejectError marks a message that can never be handled, such as one that
+// does not decode or fails validation. The runner commits past it instead
+// of retrying.
+type RejectError struct {
+	Err error
 }
 
-func (obj consumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+func (e *RejectError) Error() string { return e.Err.Error() }
 
-	for msg := range claim.Messages() {
-		// timestamp := time.Now().Format("20060102150405")
-		// obj.logger.WithFields(logrus.Fields{
-		// 	"timestamp": timestamp,
-		// 	"topic":     msg.Topic,
-		// 	"partition": msg.Partition,
-		// 	"offset":    msg.Offset,
-		// 	"key":       string(msg.Key),
-		// 	"value":     string(msg.Value),
-		// }).Info("Consume message")
+func (e *RejectError) Unwrap() error { return e.Err }
 
-		switch msg.Topic {
-		case "product.created":
+// Reject wraps err in a *RejectError.
+func Reject(err error) error { return &RejectError{Err: err} }
 
-		}
+type HandlerFunc func(ctx context.Context, msg *sarama.ConsumerMessage) error
 
-		session.MarkMessage(msg, "")
-	}
+func (f HandlerFunc) Handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	return f(ctx, msg)
+}
 
-	return nil
+// Hooks are optional callbacks for instrumentation. SessionEnded receives
+// the claims the session gave up. LagMeasured is called for every claimed
+// partition each lag interval.
+type Hooks struct {
+	SessionStarted func(claims map[string][]int32)
+	SessionEnded   func(claims map[string][]int32)
+	MessageHandled func(msg *sarama.ConsumerMessage, highWaterMark int64, elapsed time.Duration, err error)
+	LagMeasured    func(topic string, partition int32, lag int64)
 }
 
-func (obj consumerHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+type Option func(*Runner)
 
-func (obj consumerHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+func WithBrokers(brokers ...string) Option { return func(r *Runner) { r.brokers = brokers } }
 
-type Event struct {
-	Header map[string]any `json:"header"`
-	Body   any            `json:"body"`
+func WithGroup(group string) Option { return func(r *Runner) { r.group = group } }
+
+func WithTopics(topics ...string) Option { return func(r *Runner) { r.topics = topics } }
+
+func WithHandler(handler Handler) Option { return func(r *Runner) { r.handler = handler } }
+
+// WithConfig replaces the default sarama configuration. Apply WithStrategy
+// after it to override the strategy the config carries.
+func WithConfig(config *sarama.Config) Option { return func(r *Runner) { r.config = config } }
+
+func WithStrategy(strategy sarama.BalanceStrategy) Option {
+	return func(r *Runner) { r.strategy = strategy }
 }
 
-func Consume(servers []string, groupID string, topics []string, handler sarama.ConsumerGroupHandler) {
-	config := sarama.NewConfig()
-	config.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRange()
-	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+// WithSignals sets the signals that stop the runner. Defaults to SIGINT and SIGTERM.
+func WithSignals(signals ...os.Signal) Option { return func(r *Runner) { r.stopSignals = signals } }
 
-	version, err := sarama.ParseKafkaVersion("1.0.0")
-	if err != nil {
-		logrus.Error("Error parsing Kafka version", err)
+// WithToggleSignal sets the signal that pauses or resumes all consumption.
+// Defaults to SIGUSR1; nil disables it.
+func WithToggleSignal(sig os.Signal) Option { return func(r *Runner) { r.toggleSignal = sig } }
+
+func WithLogger(logger *logrus.Logger) Option { return func(r *Runner) { r.logger = logger } }
+
+// WithShutdownTimeout bounds how long Run waits for in-flight messages.
+func WithShutdownTimeout(d time.Duration) Option { return func(r *Runner) { r.shutdownTimeout = d } }
+
+// WithRetryBackoff sets the delay before the first retry of a failed
+// message and the cap it doubles up to. Defaults to 1 and 30 seconds.
+func WithRetryBackoff(initial, max time.Duration) Option {
+	return func(r *Runner) { r.retryInitial, r.retryMax = initial, max }
+}
+
+func WithHooks(hooks Hooks) Option { return func(r *Runner) { r.hooks = hooks } }
+
+// WithLagInterval sets how often Hooks.LagMeasured is called. Defaults to
+// 15 seconds; zero disables lag polling.
+func WithLagInterval(d time.Duration) Option { return func(r *Runner) { r.lagInterval = d } }
+
+// Runner owns a sarama consumer group and drives a Handler.
+type Runner struct {
+	brokers         []string
+	group           string
+	topics          []string
+	handler         Handler
+	config          *sarama.Config
+	strategy        sarama.BalanceStrategy
+	stopSignals     []os.Signal
+	toggleSignal    os.Signal
+	logger          *logrus.Logger
+	shutdownTimeout time.Duration
+	hooks           Hooks
+	lagInterval     time.Duration
+	retryInitial    time.Duration
+	retryMax        time.Duration
+
+	client    sarama.ConsumerGroup
+	flow      *FlowControl
+	active    atomic.Bool
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	claimsMu sync.Mutex
+	claimed  map[string][]int32
+}
+
+// NewRunner validates the options and connects the consumer group client.
+func NewRunner(opts ...Option) (*Runner, error) {
+	r := &Runner{
+		stopSignals:     []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+		toggleSignal:    syscall.SIGUSR1,
+		logger:          logrus.StandardLogger(),
+		shutdownTimeout: 30 * time.Second,
+		lagInterval:     15 * time.Second,
+		retryInitial:    time.Second,
+		retryMax:        30 * time.Second,
+		ready:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if len(r.brokers) == 0 {
+		return nil, errors.New("consume: no brokers")
+	}
+	if r.group == "" {
+		return nil, errors.New("consume: no group")
+	}
+	if len(r.topics) == 0 {
+		return nil, errors.New("consume: no topics")
+	}
+	if r.handler == nil {
+		return nil, errors.New("consume: no handler")
+	}
+
+	if r.config == nil {
+		r.config = sarama.NewConfig()
+		r.config.Version = sarama.V1_0_0_0
+		r.config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+	if r.strategy != nil {
+		r.config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{r.strategy}
 	}
-	config.Version = version
 
-	client, err := sarama.NewConsumerGroup(servers, groupID, config)
+	client, err := sarama.NewConsumerGroup(r.brokers, r.group, r.config)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer client.Close()
+	r.client = client
+	r.flow = NewFlowControl(client)
+	return r, nil
+}
+
+// Flow exposes pause/resume control, e.g. for an admin API.
+func (r *Runner) Flow() *FlowControl { return r.flow }
+
+// Ready is closed once the first session has been set up.
+func (r *Runner) Ready() <-chan struct{} { return r.ready }
 
-	ctx, cancel := context.WithCancel(context.Background())
+// Active reports whether the runner currently holds a group session.
+func (r *Runner) Active() bool { return r.active.Load() }
+
+// Run consumes until ctx is cancelled or a stop signal arrives, then waits
+// up to the shutdown timeout for the message in flight and closes the client.
+func (r *Runner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	var wg *sync.WaitGroup
+	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for {
-			logrus.Info("Kafka consumer has been started...")
-			if err := client.Consume(ctx, topics, handler); err != nil {
+			// `Consume` should be called inside an infinite loop, when a
+			// server-side rebalance happens, the consumer session will need to be
+			// recreated to get the new claims
+			if err := r.client.Consume(ctx, r.topics, r); err != nil {
 				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
 					return
 				}
-				logrus.Error(err)
+				r.logger.WithField(logging.FieldError, err).Error("Error from consumer")
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+				}
 			}
 			// check if context was cancelled, signaling that the consumer should stop
 			if ctx.Err() != nil {
-				logrus.Error(err)
 				return
 			}
-
 		}
 	}()
 
-	// Handle graceful shutdown
-	consumptionIsPaused := false
-	sigusr1 := make(chan os.Signal, 1)
-	signal.Notify(sigusr1, syscall.SIGUSR1)
+	if r.hooks.LagMeasured != nil && r.lagInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.pollLag(ctx)
+		}()
+	}
 
 	sigterm := make(chan os.Signal, 1)
-	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
+	if len(r.stopSignals) > 0 {
+		signal.Notify(sigterm, r.stopSignals...)
+		defer signal.Stop(sigterm)
+	}
+	toggle := make(chan os.Signal, 1)
+	if r.toggleSignal != nil {
+		signal.Notify(toggle, r.toggleSignal)
+		defer signal.Stop(toggle)
+	}
+
+	ready := r.ready
+	for keepRunning := true; keepRunning; {
+		select {
+		case <-ready:
+			r.logger.Info("Sarama consumer up and running!...")
+			ready = nil
+		case <-ctx.Done():
+			r.logger.Info("terminating: context cancelled")
+			keepRunning = false
+		case <-sigterm:
+			r.logger.Info("terminating: via signal")
+			keepRunning = false
+		case <-toggle:
+			if r.flow.Toggle() {
+				r.logger.Info("Pausing consumption")
+			} else {
+				r.logger.Info("Resuming consumption")
+			}
+		}
+	}
+
+	cancel()
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
 	select {
-	case <-sigterm:
-		logrus.Error("Received termination signal. Initiating shutdown...")
+	case <-drained:
+		r.logger.Info("consumer drained")
+	case <-time.After(r.shutdownTimeout):
+		r.logger.WithField("timeout", r.shutdownTimeout.String()).Warn("shutdown deadline reached before the consumer drained")
+	}
 
-		cancel()
-	case <-ctx.Done():
-		logrus.Error("terminating: context cancelled")
-	case <-sigusr1:
-		toggleConsumptionFlow(client, &consumptionIsPaused)
+	return r.client.Close()
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (r *Runner) Setup(session sarama.ConsumerGroupSession) error {
+	r.flow.SetAssignment(session.Claims())
+	r.setClaims(session.Claims())
+	if r.hooks.SessionStarted != nil {
+		r.hooks.SessionStarted(session.Claims())
 	}
-	// Wait for the consumer to finish processing
-	wg.Wait()
+	r.active.Store(true)
+	r.readyOnce.Do(func() { close(r.ready) })
+	return nil
 }
 
-func toggleConsumptionFlow(client sarama.ConsumerGroup, isPaused *bool) {
-	if *isPaused {
-		client.ResumeAll()
-		logrus.Info("Resuming consumption")
-	} else {
-		client.PauseAll()
-		logrus.Info("Pausing consumption")
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
+func (r *Runner) Cleanup(session sarama.ConsumerGroupSession) error {
+	r.active.Store(false)
+	r.flow.SetAssignment(map[string][]int32{})
+	r.setClaims(nil)
+	if r.hooks.SessionEnded != nil {
+		r.hooks.SessionEnded(session.Claims())
+	}
+	// Commit marked offsets now instead of waiting for the auto-commit
+	// interval, so the next owner of these partitions starts where we stopped.
+	session.Commit()
+	return nil
+}
+
+// ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
+func (r *Runner) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	r.flow.Restore(claim.Topic(), claim.Partition())
+
+	// NOTE:
+	// Do not move the code below to a goroutine.
+	// The `ConsumeClaim` itself is called within a goroutine, see:
+	// https://github.com/Shopify/sarama/blob/main/consumer_group.go#L27-L29
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !r.process(session, claim, message) {
+				return nil
+			}
+		// Return when the session ends (rebalance or shutdown). A message that
+		// was already being handled has finished by the time we get here.
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// process handles the message until it succeeds or is rejected, then marks
+// it. Other failures, such as Mongo being unavailable, are retried with
+// backoff. It returns false if the session ends first, leaving the message
+// unmarked so the partition's next owner consumes it again.
+func (r *Runner) process(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, message *sarama.ConsumerMessage) bool {
+	backoff := r.retryInitial
+	for {
+		err := r.handle(session, claim, message)
+		var rejected *RejectError
+		if err == nil || errors.As(err, &rejected) {
+			session.MarkMessage(message, "")
+			return true
+		}
+
+		r.logger.WithFields(logrus.Fields{
+			logging.FieldTopic:     message.Topic,
+			logging.FieldPartition: message.Partition,
+			logging.FieldOffset:    message.Offset,
+			"retryIn":              backoff.String(),
+		}).Warn("message failed, retrying")
+		select {
+		case <-session.Context().Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, r.retryMax)
+	}
+}
+
+// handle runs the handler on a context detached from the session's
+// cancellation so a rebalance or shutdown never interrupts a half-written
+// message.
+func (r *Runner) handle(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, message *sarama.ConsumerMessage) error {
+	headers := make(map[string]string)
+	for _, header := range message.Headers {
+		key := string(header.Key)
+		value := string(header.Value)
+		if key != "" && value != "" {
+			headers[key] = value
+		}
+	}
+
+	ctx, _ := logging.NewContext(context.WithoutCancel(session.Context()), r.logger, logging.FromKafka(headers))
+	ctx, entry := logging.WithFields(ctx, logrus.Fields{
+		logging.FieldTopic:     message.Topic,
+		logging.FieldPartition: message.Partition,
+		logging.FieldOffset:    message.Offset,
+		logging.FieldKey:       string(message.Key),
+		"sessionId":            strings.TrimPrefix(session.MemberID(), "sarama-"),
+		"generationId":         session.GenerationID(),
+	})
+
+	start := time.Now()
+	ctx, span := tracing.StartConsume(ctx, message, r.group)
+	err := r.handler.Handle(ctx, message)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	elapsed := time.Since(start)
+	if r.hooks.MessageHandled != nil {
+		r.hooks.MessageHandled(message, claim.HighWaterMarkOffset(), elapsed, err)
 	}
 
-	*isPaused = !*isPaused
+	entry.WithFields(logrus.Fields{
+		logging.FieldPayload:    logging.Payload(message.Value, logging.MaxPayload),
+		logging.FieldHeaders:    headers,
+		logging.FieldDurationMs: float64(elapsed.Microseconds()) / 1000,
+		logging.FieldError:      err,
+		"timestamp":             message.Timestamp,
+	}).Info("message consumed")
+	return err
 }
@@ -0,0 +1,83 @@
+package consume
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// fakeSession records marked offsets. Other ConsumerGroupSession methods are
+// not used and panic through the nil embedded interface.
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+func (s *fakeSession) MemberID() string         { return "sarama-test" }
+func (s *fakeSession) GenerationID() int32      { return 1 }
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+}
+
+func (fakeClaim) HighWaterMarkOffset() int64 { return 0 }
+
+func TestProcess(t *testing.T) {
+	errDown := errors.New("mongo is down")
+
+	tests := []struct {
+		name    string
+		results []error
+		cancel  bool
+		marked  bool
+		calls   int
+	}{
+		{name: "success", results: []error{nil}, marked: true, calls: 1},
+		{name: "rejected", results: []error{Reject(errors.New("bad payload"))}, marked: true, calls: 1},
+		{name: "retried until it succeeds", results: []error{errDown, errDown, nil}, marked: true, calls: 3},
+		{name: "session ends while retrying", results: []error{errDown}, cancel: true, marked: false, calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			calls := 0
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			r := &Runner{
+				logger:       logger,
+				retryInitial: time.Millisecond,
+				retryMax:     2 * time.Millisecond,
+				handler: HandlerFunc(func(context.Context, *sarama.ConsumerMessage) error {
+					err := tt.results[min(calls, len(tt.results)-1)]
+					calls++
+					if tt.cancel {
+						cancel()
+					}
+					return err
+				}),
+			}
+			session := &fakeSession{ctx: ctx}
+
+			ok := r.process(session, fakeClaim{}, &sarama.ConsumerMessage{Topic: "t", Offset: 7})
+			if ok != tt.marked || (len(session.marked) == 1) != tt.marked {
+				t.Errorf("process() = %v, marked %v, want %v", ok, session.marked, tt.marked)
+			}
+			if calls != tt.calls {
+				t.Errorf("handler called %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
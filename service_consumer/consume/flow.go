@@ -0,0 +1,260 @@
+package consume
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// FlowControl pauses and resumes consumption of the whole group, single
+// topics or single partitions.
+//
+// sarama only pauses partition consumers that already exist, so the paused
+// set is kept here and reapplied through Restore whenever a claim starts
+// after a rebalance.
+type FlowControl struct {
+	client sarama.ConsumerGroup
+
+	mu         sync.Mutex
+	all        bool
+	topics     map[string]bool
+	partitions map[string]map[int32]bool
+	assignment map[string][]int32
+}
+
+// FlowState is the JSON view of the paused set returned by the admin API.
+type FlowState struct {
+	All        bool               `json:"all"`
+	Topics     []string           `json:"topics"`
+	Partitions map[string][]int32 `json:"partitions"`
+	Paused     map[string][]int32 `json:"paused"`
+	Assignment map[string][]int32 `json:"assignment"`
+}
+
+func NewFlowControl(client sarama.ConsumerGroup) *FlowControl {
+	return &FlowControl{
+		client:     client,
+		topics:     map[string]bool{},
+		partitions: map[string]map[int32]bool{},
+		assignment: map[string][]int32{},
+	}
+}
+
+// SetAssignment records the partitions claimed by the current session.
+func (f *FlowControl) SetAssignment(claims map[string][]int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.assignment = claims
+}
+
+// Restore pauses a freshly claimed partition again if it was paused before
+// the rebalance.
+func (f *FlowControl) Restore(topic string, partition int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.isPaused(topic, partition) {
+		f.client.Pause(map[string][]int32{topic: {partition}})
+	}
+}
+
+func (f *FlowControl) PauseAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.all = true
+	f.topics = map[string]bool{}
+	f.partitions = map[string]map[int32]bool{}
+	f.client.PauseAll()
+}
+
+func (f *FlowControl) ResumeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.all = false
+	f.topics = map[string]bool{}
+	f.partitions = map[string]map[int32]bool{}
+	f.client.ResumeAll()
+}
+
+// Toggle resumes everything when anything is paused, otherwise pauses
+// everything. It backs the SIGUSR1 handler.
+func (f *FlowControl) Toggle() bool {
+	f.mu.Lock()
+	paused := f.all || len(f.topics) > 0 || len(f.partitions) > 0
+	f.mu.Unlock()
+
+	if paused {
+		f.ResumeAll()
+	} else {
+		f.PauseAll()
+	}
+	return !paused
+}
+
+// Pause pauses the listed partitions of each topic, or the whole topic when
+// its list is empty.
+func (f *FlowControl) Pause(targets map[string][]int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pause := map[string][]int32{}
+	for topic, partitions := range targets {
+		if len(partitions) == 0 {
+			f.topics[topic] = true
+			delete(f.partitions, topic)
+			pause[topic] = f.assignment[topic]
+			continue
+		}
+		if f.partitions[topic] == nil {
+			f.partitions[topic] = map[int32]bool{}
+		}
+		for _, p := range partitions {
+			f.partitions[topic][p] = true
+		}
+		pause[topic] = partitions
+	}
+	f.client.Pause(pause)
+}
+
+// Resume resumes the listed partitions of each topic, or the whole topic
+// when its list is empty.
+func (f *FlowControl) Resume(targets map[string][]int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Narrowing a broader pause turns it into explicit entries first so the
+	// rest of it stays paused.
+	if f.all {
+		f.all = false
+		for topic := range f.assignment {
+			f.topics[topic] = true
+		}
+	}
+
+	resume := map[string][]int32{}
+	for topic, partitions := range targets {
+		if len(partitions) == 0 {
+			delete(f.topics, topic)
+			delete(f.partitions, topic)
+			resume[topic] = f.assignment[topic]
+			continue
+		}
+		if f.topics[topic] {
+			delete(f.topics, topic)
+			f.partitions[topic] = map[int32]bool{}
+			for _, p := range f.assignment[topic] {
+				f.partitions[topic][p] = true
+			}
+		}
+		for _, p := range partitions {
+			delete(f.partitions[topic], p)
+		}
+		if len(f.partitions[topic]) == 0 {
+			delete(f.partitions, topic)
+		}
+		resume[topic] = partitions
+	}
+	f.client.Resume(resume)
+}
+
+func (f *FlowControl) State() FlowState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state := FlowState{
+		All:        f.all,
+		Topics:     []string{},
+		Partitions: map[string][]int32{},
+		Paused:     map[string][]int32{},
+		Assignment: f.assignment,
+	}
+	for topic := range f.topics {
+		state.Topics = append(state.Topics, topic)
+	}
+	sort.Strings(state.Topics)
+	for topic, partitions := range f.partitions {
+		for p := range partitions {
+			state.Partitions[topic] = append(state.Partitions[topic], p)
+		}
+		sortPartitions(state.Partitions[topic])
+	}
+	for topic, partitions := range f.assignment {
+		for _, p := range partitions {
+			if f.isPaused(topic, p) {
+				state.Paused[topic] = append(state.Paused[topic], p)
+			}
+		}
+		sortPartitions(state.Paused[topic])
+	}
+	return state
+}
+
+func (f *FlowControl) isPaused(topic string, partition int32) bool {
+	return f.all || f.topics[topic] || f.partitions[topic][partition]
+}
+
+// Mux is the part of an HTTP router Register needs; admin.Server and
+// http.ServeMux both satisfy it.
+type Mux interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// Register mounts the flow control API:
+//
+//	GET  /consumption         current paused set
+//	POST /consumption/pause   pause all, or {"topics": {"topic": [partitions]}}
+//	POST /consumption/resume  resume all, or {"topics": {"topic": [partitions]}}
+//
+// An empty partition list targets every partition of that topic. Mount it on
+// admin.Server, which requires the admin token for the POST endpoints.
+func (f *FlowControl) Register(s Mux) {
+	s.HandleFunc("/consumption", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, f.State())
+	})
+	s.HandleFunc("/consumption/pause", f.change(f.PauseAll, f.Pause))
+	s.HandleFunc("/consumption/resume", f.change(f.ResumeAll, f.Resume))
+}
+
+type flowRequest struct {
+	Topics map[string][]int32 `json:"topics"`
+}
+
+func (f *FlowControl) change(all func(), some func(map[string][]int32)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		var req flowRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if len(req.Topics) == 0 {
+			all()
+		} else {
+			some(req.Topics)
+		}
+		writeJSON(w, http.StatusOK, f.State())
+	}
+}
+
+func sortPartitions(partitions []int32) {
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
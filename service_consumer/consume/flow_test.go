@@ -0,0 +1,118 @@
+package consume
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeGroup records the pause calls FlowControl makes. Other ConsumerGroup
+// methods are not used and panic through the nil embedded interface.
+type fakeGroup struct {
+	sarama.ConsumerGroup
+	paused  []map[string][]int32
+	resumed []map[string][]int32
+}
+
+func (g *fakeGroup) Pause(p map[string][]int32)  { g.paused = append(g.paused, p) }
+func (g *fakeGroup) Resume(p map[string][]int32) { g.resumed = append(g.resumed, p) }
+func (g *fakeGroup) PauseAll()                   { g.paused = append(g.paused, nil) }
+func (g *fakeGroup) ResumeAll()                  { g.resumed = append(g.resumed, nil) }
+
+func TestFlowControlState(t *testing.T) {
+	assignment := map[string][]int32{"a": {0, 1, 2}, "b": {0, 1}}
+
+	tests := []struct {
+		name string
+		ops  func(f *FlowControl)
+		want map[string][]int32
+	}{
+		{
+			name: "nothing paused",
+			ops:  func(f *FlowControl) {},
+			want: map[string][]int32{},
+		},
+		{
+			name: "pause all",
+			ops:  func(f *FlowControl) { f.PauseAll() },
+			want: assignment,
+		},
+		{
+			name: "pause a topic",
+			ops:  func(f *FlowControl) { f.Pause(map[string][]int32{"b": nil}) },
+			want: map[string][]int32{"b": {0, 1}},
+		},
+		{
+			name: "pause partitions",
+			ops:  func(f *FlowControl) { f.Pause(map[string][]int32{"a": {2, 0}}) },
+			want: map[string][]int32{"a": {0, 2}},
+		},
+		{
+			name: "resume one partition after pause all",
+			ops: func(f *FlowControl) {
+				f.PauseAll()
+				f.Resume(map[string][]int32{"a": {1}})
+			},
+			want: map[string][]int32{"a": {0, 2}, "b": {0, 1}},
+		},
+		{
+			name: "resume a topic after pausing it",
+			ops: func(f *FlowControl) {
+				f.Pause(map[string][]int32{"a": nil, "b": {1}})
+				f.Resume(map[string][]int32{"a": nil})
+			},
+			want: map[string][]int32{"b": {1}},
+		},
+		{
+			name: "resume all clears everything",
+			ops: func(f *FlowControl) {
+				f.Pause(map[string][]int32{"a": nil, "b": {1}})
+				f.ResumeAll()
+			},
+			want: map[string][]int32{},
+		},
+		{
+			name: "toggle pauses when nothing is paused",
+			ops:  func(f *FlowControl) { f.Toggle() },
+			want: assignment,
+		},
+		{
+			name: "toggle resumes a partial pause",
+			ops: func(f *FlowControl) {
+				f.Pause(map[string][]int32{"b": {0}})
+				f.Toggle()
+			},
+			want: map[string][]int32{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFlowControl(&fakeGroup{})
+			f.SetAssignment(assignment)
+			tt.ops(f)
+			if got := f.State().Paused; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Paused = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowControlRestore(t *testing.T) {
+	group := &fakeGroup{}
+	f := NewFlowControl(group)
+	f.SetAssignment(map[string][]int32{"a": {0, 1}})
+	f.Pause(map[string][]int32{"a": {1}})
+	group.paused = nil
+
+	// A rebalance hands out the same partitions again.
+	f.SetAssignment(map[string][]int32{"a": {0, 1}})
+	f.Restore("a", 0)
+	f.Restore("a", 1)
+
+	want := []map[string][]int32{{"a": {1}}}
+	if !reflect.DeepEqual(group.paused, want) {
+		t.Errorf("paused after restore = %v, want %v", group.paused, want)
+	}
+}
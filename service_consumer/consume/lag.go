@@ -0,0 +1,93 @@
+package consume
+
+import (
+	"context"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sing3demons/logging"
+)
+
+// pollLag reports the lag of every claimed partition each interval, from
+// the group's committed offsets and the partitions' high-water marks. It
+// runs independently of message delivery, so paused and idle partitions
+// are still measured.
+func (r *Runner) pollLag(ctx context.Context) {
+	client, err := sarama.NewClient(r.brokers, r.config)
+	if err != nil {
+		r.logger.WithField(logging.FieldError, err).Error("lag: connect")
+		return
+	}
+	defer client.Close()
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		r.logger.WithField(logging.FieldError, err).Error("lag: connect admin")
+		return
+	}
+
+	ticker := time.NewTicker(r.lagInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.measureLag(client, admin); err != nil {
+				r.logger.WithField(logging.FieldError, err).Warn("lag: measure")
+			}
+		}
+	}
+}
+
+func (r *Runner) measureLag(client sarama.Client, admin sarama.ClusterAdmin) error {
+	claims := r.claims()
+	if len(claims) == 0 {
+		return nil
+	}
+
+	committed, err := admin.ListConsumerGroupOffsets(r.group, claims)
+	if err != nil {
+		return err
+	}
+
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			highWaterMark, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return err
+			}
+
+			// A partition the group has never committed on is behind by
+			// everything still retained.
+			offset := int64(-1)
+			if block := committed.GetBlock(topic, partition); block != nil {
+				offset = block.Offset
+			}
+			if offset < 0 {
+				if offset, err = client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+					return err
+				}
+			}
+
+			lag := highWaterMark - offset
+			if lag < 0 {
+				lag = 0
+			}
+			r.hooks.LagMeasured(topic, partition, lag)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) setClaims(claims map[string][]int32) {
+	r.claimsMu.Lock()
+	defer r.claimsMu.Unlock()
+	r.claimed = claims
+}
+
+func (r *Runner) claims() map[string][]int32 {
+	r.claimsMu.Lock()
+	defer r.claimsMu.Unlock()
+	return r.claimed
+}
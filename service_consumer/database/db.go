@@ -7,6 +7,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/sing3demons/service-consumer/config"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -14,7 +16,8 @@ import (
 
 type IMongo interface {
 	Collection(name string) *mongo.Collection
-	Disconnect()
+	Ping(ctx context.Context) error
+	Disconnect(ctx context.Context) error
 }
 
 type DB struct {
@@ -30,10 +33,37 @@ func New(dbName string) IMongo {
 	return &DB{client.Database(dbName)}
 }
 
+// Connect opens a client with the configured pool and timeout settings and
+// checks it with a ping before returning. monitor, if set, sees every
+// command the client sends.
+func Connect(cfg config.MongoConfig, monitor *event.CommandMonitor) (*DB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+
+	opts := cfg.ClientOptions()
+	if monitor != nil {
+		opts.SetMonitor(monitor)
+	}
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return &DB{client.Database(cfg.Database)}, nil
+}
+
 func (db *DB) Collection(name string) *mongo.Collection {
 	return db.Database.Collection(name)
 }
 
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Client().Ping(ctx, readpref.Primary())
+}
+
 func ConnectMonoDB() (*mongo.Client, error) {
 	uri := os.Getenv("MONGO_URL")
 	if uri == "" {
@@ -54,11 +84,6 @@ func ConnectMonoDB() (*mongo.Client, error) {
 	return client, nil
 }
 
-func (db *DB) Disconnect() {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	if err := db.Client().Disconnect(ctx); err != nil {
-		log.Fatal(err)
-	}
-}
\ No newline at end of file
+func (db *DB) Disconnect(ctx context.Context) error {
+	return db.Client().Disconnect(ctx)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sing3demons/catalog"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/produce"
+	"github.com/sing3demons/service-consumer/consume"
+	"github.com/sing3demons/service-consumer/database"
+	"github.com/sing3demons/service-consumer/metrics"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// productHandler persists product events.
+type productHandler struct {
+	productDb         *mongo.Collection
+	productLanguageDb *mongo.Collection
+	products          *store.Products
+	categories        *store.Categories
+	publisher         produce.Publisher
+	metrics           *metrics.Metrics
+	// retention is how long after deletion restore.products is honoured.
+	retention time.Duration
+}
+
+func newProductHandler(db *database.DB, products *store.Products, publisher produce.Publisher, m *metrics.Metrics, retention time.Duration) *productHandler {
+	return &productHandler{
+		productDb:         db.Collection("products"),
+		productLanguageDb: db.Collection("product_languages"),
+		products:          products,
+		categories:        store.NewCategories(db.Database, products.Audit),
+		publisher:         publisher,
+		metrics:           m,
+		retention:         retention,
+	}
+}
+
+// statusEvent is the body of status.products, status.productsLanguage and
+// status.categories. ID names the product, language or category; PriceID
+// and AttachmentID narrow a product or language change to one price or
+// attachment.
+type statusEvent struct {
+	ID           string         `json:"id"`
+	PriceID      string         `json:"priceId,omitempty"`
+	AttachmentID string         `json:"attachmentId,omitempty"`
+	Status       catalog.Status `json:"status"`
+	Reason       string         `json:"reason"`
+}
+
+// categoryEvent is the body of update.categories. It carries the full
+// name and description, so an empty description clears it.
+type categoryEvent struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// productEvent is the body of delete.products and restore.products.
+type productEvent struct {
+	ID string `json:"id"`
+}
+
+func (h *productHandler) Handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	ctx = store.WithSource(ctx, store.Source{
+		Kind:          "kafka",
+		Topic:         message.Topic,
+		Partition:     message.Partition,
+		Offset:        message.Offset,
+		CorrelationID: logging.CorrelationID(ctx),
+	})
+
+	if message.Value == nil {
+		logging.FromContext(ctx).Debug("skip tombstone")
+		return nil
+	}
+
+	switch message.Topic {
+	case "create.products":
+		result := catalog.Product{}
+		if err := h.decode(message, &result); err != nil {
+			return err
+		}
+		if err := h.validate(message, &result); err != nil {
+			return err
+		}
+		return h.write(ctx, message.Topic, h.productDb.Name(), func(ctx context.Context) error {
+			if err := h.categories.Link(ctx, result.Category); err != nil {
+				return err
+			}
+			err := h.products.Create(ctx, &result)
+			if errors.Is(err, store.ErrExists) {
+				logging.FromContext(ctx).WithField("productId", result.ID).Info("product already exists")
+				return nil
+			}
+			return err
+		})
+	case "create.productsLanguage":
+		result := catalog.SupportingLanguage{}
+		if err := h.decode(message, &result); err != nil {
+			return err
+		}
+		if err := h.validate(message, &result); err != nil {
+			return err
+		}
+		return h.write(ctx, message.Topic, h.productLanguageDb.Name(), func(ctx context.Context) error {
+			err := h.products.CreateLanguage(ctx, &result)
+			if errors.Is(err, store.ErrLanguageExists) {
+				logging.FromContext(ctx).WithField("languageId", result.ID).Info("language already exists")
+				return nil
+			}
+			return err
+		})
+	case "status.products", "status.productsLanguage", "status.categories":
+		event := statusEvent{}
+		if err := h.decode(message, &event); err != nil {
+			return err
+		}
+		return h.transition(ctx, message.Topic, event)
+	case "delete.products":
+		event := productEvent{}
+		if err := h.decode(message, &event); err != nil {
+			return err
+		}
+		return h.delete(ctx, message.Topic, event)
+	case "restore.products":
+		event := productEvent{}
+		if err := h.decode(message, &event); err != nil {
+			return err
+		}
+		return h.restore(ctx, message.Topic, event)
+	case "create.categories":
+		result := catalog.Category{}
+		if err := h.decode(message, &result); err != nil {
+			return err
+		}
+		if err := h.validate(message, &result); err != nil {
+			return err
+		}
+		return h.createCategory(ctx, message.Topic, &result)
+	case "update.categories":
+		event := categoryEvent{}
+		if err := h.decode(message, &event); err != nil {
+			return err
+		}
+		return h.renameCategory(ctx, message.Topic, event)
+	default:
+		logging.FromContext(ctx).Warn("no handler for topic")
+		return nil
+	}
+}
+
+func (h *productHandler) decode(message *sarama.ConsumerMessage, v any) error {
+	if err := json.Unmarshal(message.Value, v); err != nil {
+		h.metrics.Error(message.Topic, metrics.ErrorDecode)
+		return consume.Reject(fmt.Errorf("decode %s: %w", message.Topic, err))
+	}
+	return nil
+}
+
+// validate rejects documents that fail the catalog rules. The message is
+// still marked, so a bad event is logged and skipped rather than retried.
+func (h *productHandler) validate(message *sarama.ConsumerMessage, doc interface{ Validate() error }) error {
+	if err := doc.Validate(); err != nil {
+		return h.fail(message.Topic, err, true)
+	}
+	return nil
+}
+
+// fail counts err and returns it to the runner. A rejected event can never
+// succeed, so the runner commits past it; any other failure is retried.
+func (h *productHandler) fail(topic string, err error, rejected bool) error {
+	if rejected {
+		h.metrics.Error(topic, metrics.ErrorInvalid)
+		return consume.Reject(fmt.Errorf("reject %s: %w", topic, err))
+	}
+	h.metrics.Error(topic, metrics.ErrorPersist)
+	return fmt.Errorf("%s: %w", topic, err)
+}
+
+// transition applies a lifecycle change. Illegal transitions and unknown
+// targets are counted as invalid and skipped like any other bad event.
+// Changes that reach product documents are published to update.products.
+func (h *productHandler) transition(ctx context.Context, topic string, event statusEvent) error {
+	change := catalog.StatusChange{
+		To:     event.Status,
+		Reason: event.Reason,
+		Source: "kafka:" + topic,
+	}
+
+	var updated []string
+	var err error
+	switch {
+	case topic == "status.productsLanguage":
+		_, err = h.products.TransitionLanguage(ctx, event.ID, event.AttachmentID, change)
+	case topic == "status.categories":
+		_, updated, err = h.categories.Transition(ctx, event.ID, change)
+	case event.PriceID != "":
+		_, err = h.products.TransitionPrice(ctx, event.ID, event.PriceID, change)
+		updated = []string{event.ID}
+	default:
+		_, err = h.products.Transition(ctx, event.ID, change)
+		updated = []string{event.ID}
+	}
+	if err != nil {
+		var illegal *catalog.TransitionError
+		return h.fail(topic, err, errors.As(err, &illegal) || notFound(err))
+	}
+	h.publishUpdated(ctx, updated)
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"id":           event.ID,
+		"priceId":      event.PriceID,
+		"attachmentId": event.AttachmentID,
+		"status":       event.Status,
+	}).Info("status changed")
+	return nil
+}
+
+func notFound(err error) bool {
+	for _, target := range []error{
+		store.ErrNotFound,
+		store.ErrPriceNotFound,
+		store.ErrLanguageNotFound,
+		store.ErrAttachmentNotFound,
+		store.ErrCategoryNotFound,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// delete soft-deletes a product. Unknown and already deleted products are
+// counted as invalid and skipped.
+func (h *productHandler) delete(ctx context.Context, topic string, event productEvent) error {
+	product, err := h.products.Delete(ctx, event.ID)
+	if err != nil {
+		return h.fail(topic, err, errors.Is(err, store.ErrNotFound))
+	}
+
+	logging.FromContext(ctx).WithField("productId", product.ID).Info("product deleted")
+	return nil
+}
+
+// restore undeletes a product still inside the retention window.
+func (h *productHandler) restore(ctx context.Context, topic string, event productEvent) error {
+	product, err := h.products.Restore(ctx, event.ID, h.retention)
+	if err != nil {
+		return h.fail(topic, err, errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrNotDeleted) || errors.Is(err, store.ErrRetentionExpired))
+	}
+
+	logging.FromContext(ctx).WithField("productId", product.ID).Info("product restored")
+	return nil
+}
+
+// createCategory stores a new category. A missing parent is counted as
+// invalid and skipped; a category that already exists is a redelivery.
+func (h *productHandler) createCategory(ctx context.Context, topic string, category *catalog.Category) error {
+	err := h.categories.Create(ctx, category)
+	if mongo.IsDuplicateKeyError(err) {
+		logging.FromContext(ctx).WithField("categoryId", category.ID).Info("category already exists")
+		return nil
+	}
+	if err != nil {
+		return h.fail(topic, err, errors.Is(err, store.ErrParentNotFound))
+	}
+
+	logging.FromContext(ctx).WithField("categoryId", category.ID).Info("category created")
+	return nil
+}
+
+// renameCategory updates the category and the snapshot embedded in every
+// product that lists it, then publishes update.products for each of them.
+func (h *productHandler) renameCategory(ctx context.Context, topic string, event categoryEvent) error {
+	if event.ID == "" || event.Name == "" {
+		return h.fail(topic, errors.New("id and name are required"), true)
+	}
+
+	_, ids, err := h.categories.Rename(ctx, event.ID, event.Name, event.Description)
+	if err != nil {
+		return h.fail(topic, err, errors.Is(err, store.ErrCategoryNotFound))
+	}
+
+	h.publishUpdated(ctx, ids)
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"categoryId": event.ID,
+		"products":   len(ids),
+	}).Info("category renamed")
+	return nil
+}
+
+// publishUpdated publishes update.products for each product id so
+// node-products drops its cached copies. Failures are logged, not returned:
+// the change is already stored.
+func (h *productHandler) publishUpdated(ctx context.Context, ids []string) {
+	for _, id := range ids {
+		err := h.publisher.Publish(ctx, "update.products", produce.Event{
+			Key:  id,
+			Type: "product.updated",
+			Body: productEvent{ID: id},
+		})
+		if err != nil {
+			logging.FromContext(ctx).WithFields(logrus.Fields{
+				"productId":        id,
+				logging.FieldError: err,
+			}).Error("publish update.products")
+		}
+	}
+}
+
+// write runs one Mongo write and counts its failure. Spans and latency come
+// from the client's command monitor.
+func (h *productHandler) write(ctx context.Context, topic, collection string, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		h.metrics.Error(topic, metrics.ErrorPersist)
+		return err
+	}
+
+	logging.FromContext(ctx).WithField("collection", collection).Debug("document written")
+	return nil
+}
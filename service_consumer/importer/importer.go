@@ -0,0 +1,300 @@
+package importer
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sing3demons/catalog"
+)
+
+// Columns accepted in CSV files. They match the node-products export so a
+// spreadsheet exported from one environment can be imported into another.
+// categories is a "|"-separated list of names; the consumer links each to
+// the stored category of that name when the product is created.
+var Columns = []string{
+	"id", "name", "description", "status", "stock",
+	"priceName", "amount", "currency", "unit", "taxType", "taxValue",
+	"categories", "languageCode", "languageName", "languageDescription",
+}
+
+// Record is one product parsed from the input together with the languages
+// that are published to create.productsLanguage.
+type Record struct {
+	Line      int
+	Product   catalog.Product
+	Languages []catalog.SupportingLanguage
+}
+
+// RowError reports why a single input line was rejected.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// ParseCSV reads rows keyed by the header line. Rows that share an id are
+// merged into the first of them, wherever they appear, so each extra row can
+// add another language.
+func ParseCSV(r io.Reader) ([]*Record, []RowError) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, []RowError{{Line: 1, Err: fmt.Errorf("read header: %w", err)}}
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, []RowError{{Line: 1, Err: errors.New(`header must contain a "name" column`)}}
+	}
+
+	var records []*Record
+	var errs []RowError
+	byID := map[string]*Record{}
+	line := 1
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Err: err})
+			continue
+		}
+
+		get := func(column string) string {
+			if i, ok := index[column]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		language, err := parseLanguage(get)
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Err: err})
+			continue
+		}
+
+		if id := get("id"); id != "" {
+			if record, ok := byID[id]; ok {
+				if language != nil {
+					record.Languages = append(record.Languages, *language)
+				}
+				continue
+			}
+		}
+
+		product, err := parseProduct(get)
+		if err != nil {
+			errs = append(errs, RowError{Line: line, Err: err})
+			continue
+		}
+
+		record := &Record{Line: line, Product: product}
+		if language != nil {
+			record.Languages = append(record.Languages, *language)
+		}
+		records = append(records, record)
+		if product.ID != "" {
+			byID[product.ID] = record
+		}
+	}
+
+	return records, errs
+}
+
+// ParseNDJSON reads one product per line. Languages embedded in
+// SupportingLanguage are split out into their own records.
+func ParseNDJSON(r io.Reader) ([]*Record, []RowError) {
+	var records []*Record
+	var errs []RowError
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var product catalog.Product
+		if err := json.Unmarshal([]byte(text), &product); err != nil {
+			errs = append(errs, RowError{Line: line, Err: err})
+			continue
+		}
+
+		record := &Record{Line: line, Product: product}
+		for _, language := range product.SupportingLanguage {
+			if language != nil {
+				record.Languages = append(record.Languages, *language)
+			}
+		}
+		record.Product.SupportingLanguage = nil
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, RowError{Line: line + 1, Err: err})
+	}
+
+	return records, errs
+}
+
+// Validate fills in ids, timestamps and the language references embedded in
+// the product, the same shape node-service publishes, and then checks the
+// result against the catalog rules.
+func (r *Record) Validate(now time.Time) error {
+	p := &r.Product
+	timestamp := now.UTC()
+	if p.ID == "" {
+		p.ID = generateID()
+	}
+	if p.Status == "" {
+		p.Status = catalog.StatusActive
+	}
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = timestamp
+	}
+	p.UpdatedAt = timestamp
+
+	p.SupportingLanguage = nil
+	for i := range r.Languages {
+		language := &r.Languages[i]
+		if language.ID == "" {
+			language.ID = generateID()
+		}
+		if language.Status == "" {
+			language.Status = p.Status
+		}
+		if language.CreatedAt.IsZero() {
+			language.CreatedAt = timestamp
+		}
+		language.UpdatedAt = timestamp
+
+		p.SupportingLanguage = append(p.SupportingLanguage, &catalog.SupportingLanguage{
+			ID:           language.ID,
+			Name:         language.Name,
+			LanguageCode: language.LanguageCode,
+		})
+	}
+
+	result := &catalog.ValidationError{}
+	var invalid *catalog.ValidationError
+	if err := p.Validate(); errors.As(err, &invalid) {
+		result.Fields = append(result.Fields, invalid.Fields...)
+	}
+	for i := range r.Languages {
+		if err := r.Languages[i].Validate(); errors.As(err, &invalid) {
+			for _, f := range invalid.Fields {
+				f.Field = fmt.Sprintf("SupportingLanguage[%d].%s", i, f.Field)
+				result.Fields = append(result.Fields, f)
+			}
+		}
+	}
+	if len(result.Fields) > 0 {
+		return result
+	}
+	return nil
+}
+
+func parseProduct(get func(string) string) (catalog.Product, error) {
+	product := catalog.Product{
+		ID:          get("id"),
+		Name:        get("name"),
+		Description: get("description"),
+		Status:      catalog.Status(get("status")),
+	}
+
+	if v := get("stock"); v != "" {
+		stock, err := strconv.Atoi(v)
+		if err != nil {
+			return product, fmt.Errorf("stock: %w", err)
+		}
+		product.Stock = stock
+	}
+
+	if amount := get("amount"); amount != "" || get("priceName") != "" {
+		price := &catalog.Price{
+			ID:     generateID(),
+			Name:   get("priceName"),
+			Status: product.Status,
+		}
+		if amount != "" {
+			value, err := catalog.ParseAmount(amount)
+			if err != nil {
+				return product, fmt.Errorf("amount: %w", err)
+			}
+			price.UnitOfMeasure = &catalog.UnitOfMeasure{
+				Unit:     get("unit"),
+				Amount:   value,
+				Currency: get("currency"),
+			}
+		}
+		if taxValue := get("taxValue"); taxValue != "" || get("taxType") != "" {
+			price.Tax = &catalog.Tax{Type: catalog.TaxType(get("taxType"))}
+			if taxValue != "" {
+				value, err := catalog.ParseAmount(taxValue)
+				if err != nil {
+					return product, fmt.Errorf("taxValue: %w", err)
+				}
+				price.Tax.Value = value
+			}
+		}
+		product.Price = append(product.Price, price)
+	}
+
+	if categories := get("categories"); categories != "" {
+		for _, name := range strings.Split(categories, "|") {
+			if name = strings.TrimSpace(name); name != "" {
+				product.Category = append(product.Category, &catalog.Category{Name: name})
+			}
+		}
+	}
+
+	return product, nil
+}
+
+func parseLanguage(get func(string) string) (*catalog.SupportingLanguage, error) {
+	code := get("languageCode")
+	if code == "" {
+		if get("languageName") != "" || get("languageDescription") != "" {
+			return nil, errors.New("languageCode is required when languageName or languageDescription is set")
+		}
+		return nil, nil
+	}
+
+	return &catalog.SupportingLanguage{
+		Name:         get("languageName"),
+		Description:  get("languageDescription"),
+		LanguageCode: code,
+	}, nil
+}
+
+const idAlphabet = "0123456789AaBbCcDdEeFfGgHhIiJjKkLlMmNnOoPpQqRrSsTtUuVvWwXxYyZz"
+
+// generateID returns an 11 character id from the same alphabet node-service uses.
+func generateID() string {
+	b := make([]byte, 11)
+	rand.Read(b)
+	for i := range b {
+		b[i] = idAlphabet[int(b[i])%len(idAlphabet)]
+	}
+	return string(b)
+}
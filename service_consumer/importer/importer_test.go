@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSV(t *testing.T) {
+	input := strings.Join([]string{
+		"id,name,status,stock,priceName,amount,currency,unit,taxType,taxValue,categories,languageCode,languageName",
+		"p1,Coffee,active,5,regular,45.50,THB,cup,percentage,7,Drinks| Hot ,en,Coffee",
+		"p1,,,,,,,,,,,th,กาแฟ",
+		"p2,Tea,,x,,,,,,,,,",
+		",Cake,draft,,,,,,,,,,Cake",
+		",Water,,,,,,,,,,,",
+	}, "\n")
+
+	records, errs := ParseCSV(strings.NewReader(input))
+
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v, want 2", errs)
+	}
+	for i, line := range []int{4, 5} {
+		if errs[i].Line != line {
+			t.Errorf("errors[%d].Line = %d, want %d", i, errs[i].Line, line)
+		}
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("records = %d, want 2", len(records))
+	}
+	coffee := records[0]
+	if coffee.Product.ID != "p1" || coffee.Product.Stock != 5 || coffee.Line != 2 {
+		t.Errorf("coffee = %+v", coffee.Product)
+	}
+	if len(coffee.Languages) != 2 || coffee.Languages[1].LanguageCode != "th" {
+		t.Errorf("coffee languages = %+v, want en and th", coffee.Languages)
+	}
+	price := coffee.Product.Price[0]
+	if got := fmt.Sprint(price.UnitOfMeasure.Amount); got != "45.5" {
+		t.Errorf("coffee amount = %s, want 45.5", got)
+	}
+	if string(price.Tax.Type) != "percentage" || string(price.Status) != "active" {
+		t.Errorf("coffee price = %+v", price)
+	}
+	if got := len(coffee.Product.Category); got != 2 || coffee.Product.Category[1].Name != "Hot" {
+		t.Errorf("coffee categories = %d, want Drinks and Hot", got)
+	}
+	if records[1].Product.Name != "Water" || records[1].Product.Price != nil {
+		t.Errorf("water = %+v", records[1].Product)
+	}
+}
+
+func TestParseCSVHeader(t *testing.T) {
+	_, errs := ParseCSV(strings.NewReader("id,stock\np1,1\n"))
+	if len(errs) != 1 || errs[0].Line != 1 {
+		t.Errorf("errors = %v, want one on the header line", errs)
+	}
+}
+
+func TestParseNDJSON(t *testing.T) {
+	input := `{"id":"p1","name":"Coffee","SupportingLanguage":[{"languageCode":"th","name":"กาแฟ"}]}
+
+not json
+{"id":"p2","name":"Tea"}
+`
+	records, errs := ParseNDJSON(strings.NewReader(input))
+	if len(errs) != 1 || errs[0].Line != 3 {
+		t.Errorf("errors = %v, want one on line 3", errs)
+	}
+	if len(records) != 2 {
+		t.Fatalf("records = %d, want 2", len(records))
+	}
+	if records[0].Product.SupportingLanguage != nil || len(records[0].Languages) != 1 {
+		t.Errorf("languages were not split out: %+v", records[0])
+	}
+}
+
+func TestRecordValidate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr bool
+	}{
+		{name: "valid", csv: "name,languageCode\nCoffee,th\n"},
+		{name: "missing name", csv: "name,description\n,Coffee\n", wantErr: true},
+		{name: "negative stock", csv: "name,stock\nCoffee,-1\n", wantErr: true},
+		{name: "duplicate language", csv: "id,name,languageCode\np1,Coffee,th\np1,,TH\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, errs := ParseCSV(strings.NewReader(tt.csv))
+			if len(errs) != 0 || len(records) != 1 {
+				t.Fatalf("ParseCSV() = %d records, errors %v", len(records), errs)
+			}
+			record := records[0]
+			err := record.Validate(now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			p := record.Product
+			if p.ID == "" || string(p.Status) != "active" {
+				t.Errorf("defaults not filled: %+v", p)
+			}
+			if len(p.SupportingLanguage) != 1 || p.SupportingLanguage[0].ID != record.Languages[0].ID {
+				t.Errorf("language reference = %+v", p.SupportingLanguage)
+			}
+		})
+	}
+}
@@ -2,20 +2,25 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
 	"os"
-	"os/signal"
-	"strings"
-	"sync"
-	"syscall"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/mongometrics"
+	"github.com/sing3demons/produce"
+	"github.com/sing3demons/service-consumer/admin"
+	"github.com/sing3demons/service-consumer/config"
+	"github.com/sing3demons/service-consumer/consume"
 	"github.com/sing3demons/service-consumer/database"
+	"github.com/sing3demons/service-consumer/metrics"
+	"github.com/sing3demons/service-consumer/purge"
+	"github.com/sing3demons/tracing"
 	"github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var logger *logrus.Logger
@@ -28,30 +33,21 @@ func init() {
 	logger.SetLevel(logrus.InfoLevel)
 }
 
-const (
-	assignor = "sticky"
-	oldest   = true
-	verbose  = false
-	group    = "kafka-for-dev"
-	version  = "1.0.0"
-)
-
 func main() {
-
-	brokers := os.Getenv("KAFKA_BROKERS")
-	topics := os.Getenv("KAFKA_TOPICS")
-
-	keepRunning := true
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
 
 	hostName, err := os.Hostname()
 	logger.WithFields(logrus.Fields{
-		"brokers":  brokers,
-		"topics":   topics,
-		"group":    group,
-		"assignor": assignor,
-		"oldest":   oldest,
-		"verbose":  verbose,
-		"version":  version,
+		"brokers":  cfg.Kafka.Brokers,
+		"topics":   cfg.Kafka.Topics,
+		"group":    cfg.Kafka.Group,
+		"assignor": cfg.Kafka.Assignor,
+		"oldest":   cfg.Kafka.Oldest,
+		"verbose":  cfg.Verbose,
+		"version":  cfg.Kafka.Version,
 		"hostName": hostName,
 		"pid":      os.Getpid(),
 		"ppid":     os.Getppid(),
@@ -60,285 +56,108 @@ func main() {
 		"error":    err,
 	}).Info("Starting a new Sarama consumer")
 
-	if verbose {
+	if cfg.Verbose {
 		sarama.Logger = logger
 	}
 
-	version, err := sarama.ParseKafkaVersion(version)
+	shutdownTracing, err := tracing.Init(context.Background(), "service-consumer")
 	if err != nil {
-		logger.Panicf("Error parsing Kafka version: %v", err)
+		logger.Panicf("Error initialising tracing: %v", err)
 	}
+	defer shutdownTracing(context.Background())
 
-	/**
-	 * Construct a new Sarama configuration.
-	 * The Kafka cluster version has to be defined before the consumer/producer is initialized.
-	 */
-	config := sarama.NewConfig()
-	config.Version = version
-
-	switch assignor {
-	case "sticky":
-		config.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRange()
-	case "roundrobin":
-		config.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRange()
-	case "range":
-		config.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRange()
-	default:
-		logger.Panicf("Unrecognized consumer group partition assignor: %s", assignor)
+	saramaConfig, err := cfg.Kafka.Sarama()
+	if err != nil {
+		logger.Panicf("Error building sarama config: %v", err)
 	}
 
-	if oldest {
-		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	m := metrics.New(saramaConfig.MetricRegistry)
+	db, err := database.Connect(cfg.Mongo, tracing.MongoMonitor(mongometrics.Monitor(m.Registry)))
+	if err != nil {
+		logger.Panicf("Error connecting to MongoDB: %v", err)
 	}
 
-	/**
-	 * Setup a new Sarama consumer group
-	 */
-	consumer := Consumer{
-		ready: make(chan bool),
+	migrated, err := store.MigrateLegacy(context.Background(), db.Database)
+	if err != nil {
+		logger.Panicf("Error migrating legacy products: %v", err)
+	}
+	if migrated > 0 {
+		logger.WithField("documents", migrated).Info("migrated legacy product documents")
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	client, err := sarama.NewConsumerGroup(strings.Split(brokers, ","), group, config)
+	products := store.NewProducts(db.Database)
+	products.Audit.OnError = func(ctx context.Context, err error) {
+		logging.FromContext(ctx).WithField(logging.FieldError, err).Error("write audit entry")
+	}
+	// Without the unique id index a redelivered create.products would store
+	// a second copy of the product.
+	if err := products.EnsureIndexes(context.Background()); err != nil {
+		logger.Panicf("Error creating product indexes: %v", err)
+	}
+	producerConfig, err := cfg.Kafka.Producer()
+	if err != nil {
+		logger.Panicf("Error building producer config: %v", err)
+	}
+	publisher, err := produce.NewSyncProducer(cfg.Kafka.Brokers, producerConfig)
+	if err != nil {
+		logger.Panicf("Error creating producer: %v", err)
+	}
+	defer publisher.Close()
+
+	runner, err := consume.NewRunner(
+		consume.WithBrokers(cfg.Kafka.Brokers...),
+		consume.WithGroup(cfg.Kafka.Group),
+		consume.WithTopics(cfg.Kafka.Topics...),
+		consume.WithConfig(saramaConfig),
+		consume.WithHandler(newProductHandler(db, products, publisher, m, cfg.Purge.Retention)),
+		consume.WithLogger(logger),
+		consume.WithShutdownTimeout(cfg.ShutdownTimeout),
+		consume.WithHooks(consume.Hooks{
+			SessionStarted: func(map[string][]int32) { m.Rebalanced() },
+			SessionEnded:   m.Released,
+			MessageHandled: func(msg *sarama.ConsumerMessage, _ int64, elapsed time.Duration, _ error) {
+				m.ObserveHandler(msg.Topic, elapsed)
+				m.Consumed(msg.Topic, msg.Partition)
+			},
+			LagMeasured: m.Lag,
+		}),
+	)
 	if err != nil {
 		logger.Panicf("Error creating consumer group client: %v", err)
 	}
 
-	consumptionIsPaused := false
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for {
-			// `Consume` should be called inside an infinite loop, when a
-			// server-side rebalance happens, the consumer session will need to be
-			// recreated to get the new claims
-			if err := client.Consume(ctx, strings.Split(topics, ","), &consumer); err != nil {
-				logger.Panicf("Error from consumer: %v", err)
-			}
-			// check if context was cancelled, signaling that the consumer should stop
-			if ctx.Err() != nil {
-				return
-			}
-			consumer.ready = make(chan bool)
-		}
-	}()
-
-	<-consumer.ready // Await till the consumer has been set up
-	logger.Info("Sarama consumer up and running!...")
-
-	sigusr1 := make(chan os.Signal, 1)
-	signal.Notify(sigusr1, syscall.SIGUSR1)
-
-	sigterm := make(chan os.Signal, 1)
-	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
-
-	for keepRunning {
-		select {
-		case <-ctx.Done():
-			logger.Info("terminating: context cancelled")
-			keepRunning = false
-		case <-sigterm:
-			logger.Info("terminating: via signal")
-			keepRunning = false
-		case <-sigusr1:
-			toggleConsumptionFlow(client, &consumptionIsPaused)
+	adminServer := admin.NewServer(cfg.Admin.Addr, cfg.Admin.Token, logger)
+	adminServer.AddReadinessCheck("kafka", func(context.Context) error {
+		if !runner.Active() {
+			return errors.New("no active consumer group session")
 		}
+		return nil
+	})
+	adminServer.AddReadinessCheck("mongo", db.Ping)
+	adminServer.AddLivenessCheck("process", func(context.Context) error { return nil })
+	adminServer.Handle("/metrics", promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{}))
+	runner.Flow().Register(adminServer)
+
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if cfg.Purge.Enabled {
+		purger := purge.NewWorker(cfg.Purge, products, publisher, m, logger)
+		purger.Register(adminServer)
+		go purger.Run(jobCtx)
 	}
-	cancel()
-	wg.Wait()
-	if err = client.Close(); err != nil {
-		logger.Panicf("Error closing client: %v", err)
-	}
-}
+	adminServer.Start()
 
-func toggleConsumptionFlow(client sarama.ConsumerGroup, isPaused *bool) {
-	if *isPaused {
-		client.ResumeAll()
-		log.Println("Resuming consumption")
-	} else {
-		client.PauseAll()
-		log.Println("Pausing consumption")
+	if err := runner.Run(context.Background()); err != nil {
+		logger.WithField(logging.FieldError, err).Error("Error closing client")
 	}
+	stopJobs()
 
-	*isPaused = !*isPaused
-}
-
-// Consumer represents a Sarama consumer group consumer
-type Consumer struct {
-	ready chan bool
-}
-
-// Setup is run at the beginning of a new session, before ConsumeClaim
-func (consumer *Consumer) Setup(sarama.ConsumerGroupSession) error {
-	// Mark the consumer as ready
-	close(consumer.ready)
-	return nil
-}
-
-// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
-func (consumer *Consumer) Cleanup(sarama.ConsumerGroupSession) error {
-	return nil
-}
-
-// ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
-func (consumer *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	db := database.New("products")
-	productDb := db.Collection("products")
-	productLanguageDb := db.Collection("product_languages")
-	// NOTE:
-	// Do not move the code below to a goroutine.
-	// The `ConsumeClaim` itself is called within a goroutine, see:
-	// https://github.com/Shopify/sarama/blob/main/consumer_group.go#L27-L29
-	for message := range claim.Messages() {
-
-		sessionId := strings.TrimPrefix(session.MemberID(), "sarama-")
-		id := session.GenerationID()
-		headers := make(Header)
-		for _, header := range message.Headers {
-			key := string(header.Key)
-			value := string(header.Value)
-			if key != "" && value != "" {
-				headers[key] = value
-			}
-		}
-
-		data := Message{
-			Partition: message.Partition,
-			Offset:    message.Offset,
-			Key:       string(message.Key),
-			Value:     string(message.Value),
-			Timestamp: message.Timestamp,
-			Headers:   headers,
-			Topic:     message.Topic,
-			SessionID: sessionId,
-			ID:        id,
-		}
-
-		var insertOneResult *mongo.InsertOneResult
-		var err error
-		switch message.Topic {
-		case "create.products":
-			result := Product{}
-			json.Unmarshal([]byte(data.Value), &result)
-			insertOneResult, err = productDb.InsertOne(context.Background(), result)
-		case "create.productsLanguage":
-			result := SupportingLanguage{}
-			json.Unmarshal([]byte(data.Value), &result)
-			insertOneResult, err = productLanguageDb.InsertOne(context.Background(), result)
-		default:
-			logger.Info("topic: "+message.Topic, " not found")
-		}
-
-		logger.WithFields(logrus.Fields{
-			"partition":  data.Partition,
-			"offset":     data.Offset,
-			"key":        data.Key,
-			"value":      data.Value,
-			"timestamp":  data.Timestamp,
-			"headers":    data.Headers,
-			"topic":      data.Topic,
-			"session_id": data.SessionID,
-			"id":         data.ID,
-			"result":     insertOneResult,
-			"error":      err,
-		}).Info("topic: ", message.Topic)
-
-		session.MarkMessage(message, "")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := adminServer.Shutdown(ctx); err != nil {
+		logger.WithField(logging.FieldError, err).Error("Error closing admin server")
+	}
+	if err := db.Disconnect(ctx); err != nil {
+		logger.WithField(logging.FieldError, err).Error("Error disconnecting MongoDB")
 	}
-
-	return nil
-}
-
-type Header map[string]string
-type Message struct {
-	Partition int32     `json:"partition,omitempty"`
-	Offset    int64     `json:"offset,omitempty"`
-	Key       string    `json:"key,omitempty"`
-	Value     string    `json:"value,omitempty"`
-	Timestamp time.Time `json:"@timestamp,omitempty"`
-	Headers   Header    `json:"headers,omitempty"`
-	Topic     string    `json:"topic,omitempty"`
-	SessionID string    `json:"session_id,omitempty"`
-	ID        int32     `json:"id,omitempty"`
-}
-
-type Price struct {
-	ID                 string                `json:"id,omitempty"`
-	Name               string                `json:"name,omitempty"`
-	Tax                *Tax                  `json:"tax,omitempty"`
-	PopRelationships   []*PopRelationship    `json:"popRelationship,omitempty"`
-	UnitOfMeasure      *UnitOfMeasure        `json:"unitOfMeasure,omitempty"`
-	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty"`
-	Status             string                `json:"status,omitempty"`
-	CreatedAt          string                `json:"createdAt,omitempty"`
-	UpdatedAt          string                `json:"updatedAt,omitempty"`
-}
-
-type Tax struct {
-	Type  string  `json:"type,omitempty"`
-	Value float64 `json:"value,omitempty"`
-}
-
-type PopRelationship struct {
-	ID   string `json:"id,omitempty"`
-	Name string `json:"name,omitempty"`
-}
-
-type UnitOfMeasure struct {
-	Unit     string  `json:"unit,omitempty"`
-	Amount   float64 `json:"amount,omitempty"`
-	Currency string  `json:"currency,omitempty"`
-}
-
-type Category struct {
-	ID                 string                `json:"id,omitempty"`
-	Name               string                `json:"name,omitempty"`
-	Description        string                `json:"description,omitempty"`
-	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty"`
-	Status             string                `json:"status,omitempty"`
-	CreatedAt          string                `json:"createdAt,omitempty"`
-	UpdatedAt          string                `json:"updatedAt,omitempty"`
-}
-
-type SupportingLanguage struct {
-	ID            string         `json:"id,omitempty"`
-	Name          string         `json:"name,omitempty"`
-	Description   string         `json:"description,omitempty"`
-	LanguageCode  string         `json:"languageCode,omitempty"`
-	UnitOfMeasure *UnitOfMeasure `json:"unitOfMeasure,omitempty"`
-	Attachment    []*Attachment  `json:"attachment,omitempty"`
-	Status        string         `json:"status,omitempty"`
-	CreatedAt     string         `json:"createdAt,omitempty"`
-	UpdatedAt     string         `json:"updatedAt,omitempty"`
-}
-
-type Attachment struct {
-	ID          string   `json:"id,omitempty"`
-	Name        string   `json:"name,omitempty"`
-	URL         string   `json:"url,omitempty"`
-	Type        string   `json:"type,omitempty"`
-	Status      string   `json:"status,omitempty"`
-	CreatedAt   string   `json:"createdAt,omitempty"`
-	UpdatedAt   string   `json:"updatedAt,omitempty"`
-	Display     *Display `json:"display,omitempty"`
-	RedirectURL string   `json:"redirectUrl,omitempty"`
-}
-
-type Display struct {
-	Type  string `json:"type,omitempty"`
-	Value string `json:"value,omitempty"`
-}
-
-type Product struct {
-	ID                 string                `json:"id,omitempty"`
-	Name               string                `json:"name,omitempty"`
-	Price              []*Price              `json:"price,omitempty"`
-	Category           []*Category           `json:"category,omitempty"`
-	Description        string                `json:"description,omitempty"`
-	Stock              int                   `json:"stock,omitempty"`
-	Status             string                `json:"status,omitempty"`
-	CreatedAt          string                `json:"createdAt,omitempty"`
-	UpdatedAt          string                `json:"updatedAt,omitempty"`
-	SupportingLanguage []*SupportingLanguage `json:"SupportingLanguage,omitempty"`
 }
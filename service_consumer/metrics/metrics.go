@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// Error kinds used for the errors_total counter.
+const (
+	ErrorDecode  = "decode"
+	ErrorInvalid = "invalid"
+	ErrorPersist = "persist"
+)
+
+// Metrics holds the consumer's Prometheus collectors.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	consumed   *prometheus.CounterVec
+	handler    *prometheus.HistogramVec
+	errors     *prometheus.CounterVec
+	lag        *prometheus.GaugeVec
+	rebalances prometheus.Counter
+	purged     *prometheus.CounterVec
+}
+
+// New registers the consumer metrics and bridges sarama's go-metrics
+// registry into the same Prometheus registry.
+func New(saramaRegistry gometrics.Registry) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "consumer",
+			Name:      "messages_consumed_total",
+			Help:      "Messages consumed per topic and partition.",
+		}, []string{"topic", "partition"}),
+		handler: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "consumer",
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent handling one message.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "consumer",
+			Name:      "errors_total",
+			Help:      "Message handling errors by topic and kind.",
+		}, []string{"topic", "kind"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "consumer",
+			Name:      "lag",
+			Help:      "Messages between the committed offset and the partition high-water mark.",
+		}, []string{"topic", "partition"}),
+		rebalances: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "consumer",
+			Name:      "rebalances_total",
+			Help:      "Consumer group sessions started.",
+		}),
+		purged: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "consumer",
+			Name:      "purged_total",
+			Help:      "Documents removed by the purge job, and products it failed on.",
+		}, []string{"kind"}),
+	}
+
+	m.Registry.MustRegister(
+		m.consumed, m.handler, m.errors, m.lag, m.rebalances, m.purged,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if saramaRegistry != nil {
+		m.Registry.MustRegister(&saramaCollector{registry: saramaRegistry})
+	}
+	return m
+}
+
+func (m *Metrics) Consumed(topic string, partition int32) {
+	m.consumed.WithLabelValues(topic, strconv.Itoa(int(partition))).Inc()
+}
+
+// Lag sets the partition lag: the messages between the group's committed
+// offset and the high-water mark.
+func (m *Metrics) Lag(topic string, partition int32, lag int64) {
+	m.lag.WithLabelValues(topic, strconv.Itoa(int(partition))).Set(float64(lag))
+}
+
+// Released drops the lag of partitions this instance no longer owns, so a
+// rebalance does not leave stale lag behind. The consumed counters stay:
+// deleting them would reset the series and break rate() across rebalances.
+func (m *Metrics) Released(claims map[string][]int32) {
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			m.lag.DeleteLabelValues(topic, strconv.Itoa(int(partition)))
+		}
+	}
+}
+
+func (m *Metrics) ObserveHandler(topic string, elapsed time.Duration) {
+	m.handler.WithLabelValues(topic).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) Error(topic, kind string) {
+	m.errors.WithLabelValues(topic, kind).Inc()
+}
+
+func (m *Metrics) Rebalanced() {
+	m.rebalances.Inc()
+}
+
+func (m *Metrics) Purged(products int, languages int64, failed int) {
+	m.purged.WithLabelValues("products").Add(float64(products))
+	m.purged.WithLabelValues("languages").Add(float64(languages))
+	m.purged.WithLabelValues("errors").Add(float64(failed))
+}
+
+// saramaCollector exports sarama's go-metrics as gauges on every scrape.
+// Meters and histograms are reduced to their rate and percentile values.
+type saramaCollector struct {
+	registry gometrics.Registry
+}
+
+var saramaDesc = prometheus.NewDesc("sarama_metric", "sarama go-metrics value.", []string{"name", "stat"}, nil)
+
+// Describe sends nothing, which makes this an unchecked collector: the
+// metric names only become known once sarama has created them.
+func (c *saramaCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *saramaCollector) Collect(ch chan<- prometheus.Metric) {
+	c.registry.Each(func(name string, metric interface{}) {
+		emit := func(stat string, value float64) {
+			ch <- prometheus.MustNewConstMetric(saramaDesc, prometheus.GaugeValue, value, sanitize(name), stat)
+		}
+
+		switch m := metric.(type) {
+		case gometrics.Counter:
+			emit("count", float64(m.Count()))
+		case gometrics.Gauge:
+			emit("value", float64(m.Value()))
+		case gometrics.GaugeFloat64:
+			emit("value", m.Value())
+		case gometrics.Meter:
+			s := m.Snapshot()
+			emit("count", float64(s.Count()))
+			emit("rate1", s.Rate1())
+			emit("rate_mean", s.RateMean())
+		case gometrics.Histogram:
+			s := m.Snapshot()
+			emit("count", float64(s.Count()))
+			emit("mean", s.Mean())
+			emit("p50", s.Percentile(0.5))
+			emit("p99", s.Percentile(0.99))
+		case gometrics.Timer:
+			s := m.Snapshot()
+			emit("count", float64(s.Count()))
+			emit("mean", s.Mean())
+			emit("p99", s.Percentile(0.99))
+		}
+	})
+}
+
+func sanitize(name string) string {
+	return strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
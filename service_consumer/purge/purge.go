@@ -0,0 +1,120 @@
+// Package purge hard-deletes products that have been soft-deleted for
+// longer than the retention period.
+package purge
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sing3demons/catalog"
+	"github.com/sing3demons/catalog/store"
+	"github.com/sing3demons/logging"
+	"github.com/sing3demons/produce"
+	"github.com/sing3demons/service-consumer/admin"
+	"github.com/sing3demons/service-consumer/config"
+	"github.com/sing3demons/service-consumer/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+type Worker struct {
+	cfg       config.PurgeConfig
+	products  *store.Products
+	publisher produce.Publisher
+	metrics   *metrics.Metrics
+	logger    *logrus.Logger
+
+	// running serialises scheduled and manual runs.
+	running sync.Mutex
+	mu      sync.RWMutex
+	last    *store.PurgeReport
+}
+
+func NewWorker(cfg config.PurgeConfig, products *store.Products, publisher produce.Publisher, m *metrics.Metrics, logger *logrus.Logger) *Worker {
+	return &Worker{cfg: cfg, products: products, publisher: publisher, metrics: m, logger: logger}
+}
+
+// Run purges every Interval until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.RunOnce(ctx)
+		}
+	}
+}
+
+// RunOnce purges one batch and publishes a tombstone for each product
+// removed.
+func (w *Worker) RunOnce(ctx context.Context) (store.PurgeReport, error) {
+	w.running.Lock()
+	defer w.running.Unlock()
+
+	ctx, entry := logging.NewContext(ctx, w.logger, logging.NewID())
+	ctx = store.WithSource(ctx, store.Source{Kind: "job", Job: "purge", CorrelationID: logging.CorrelationID(ctx)})
+
+	cutoff := time.Now().Add(-w.cfg.Retention)
+	report, err := w.products.Purge(ctx, cutoff, w.cfg.BatchSize, func(ctx context.Context, product *catalog.Product) error {
+		return w.publisher.Publish(ctx, w.cfg.TombstoneTopic, produce.Event{
+			Key:  product.ID,
+			Type: "product.purged",
+		})
+	})
+	if err != nil {
+		entry.WithField(logging.FieldError, err).Error("purge failed")
+		return report, err
+	}
+
+	w.metrics.Purged(len(report.Products), report.Languages, len(report.Errors))
+	w.mu.Lock()
+	w.last = &report
+	w.mu.Unlock()
+
+	fields := logrus.Fields{
+		"cutoff":    report.Cutoff,
+		"products":  report.Products,
+		"languages": report.Languages,
+	}
+	if len(report.Errors) > 0 {
+		entry.WithFields(fields).WithField("errors", report.Errors).Warn("purge finished with errors")
+	} else if len(report.Products) > 0 {
+		entry.WithFields(fields).Info("purge finished")
+	}
+	return report, nil
+}
+
+// Register mounts the purge API on the admin server:
+//
+//	GET  /purge   the last report
+//	POST /purge   run a batch now and return its report
+//
+// The admin server refuses the POST without the admin token.
+func (w *Worker) Register(s *admin.Server) {
+	s.HandleFunc("/purge", func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.mu.RLock()
+			last := w.last
+			w.mu.RUnlock()
+			if last == nil {
+				admin.WriteJSON(rw, http.StatusNotFound, map[string]string{"error": "no purge has run yet"})
+				return
+			}
+			admin.WriteJSON(rw, http.StatusOK, last)
+		case http.MethodPost:
+			report, err := w.RunOnce(r.Context())
+			if err != nil {
+				admin.WriteJSON(rw, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			admin.WriteJSON(rw, http.StatusOK, report)
+		default:
+			admin.WriteJSON(rw, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ConsumerCarrier reads trace context from consumed message headers.
+type ConsumerCarrier []*sarama.RecordHeader
+
+func (c ConsumerCarrier) Get(key string) string {
+	for _, h := range c {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c ConsumerCarrier) Set(string, string) {}
+
+func (c ConsumerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for _, h := range c {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
+
+// ProducerCarrier writes trace context into the headers of a message
+// about to be produced.
+type ProducerCarrier struct {
+	Msg *sarama.ProducerMessage
+}
+
+func (c ProducerCarrier) Get(key string) string {
+	for _, h := range c.Msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c ProducerCarrier) Set(key, value string) {
+	for i, h := range c.Msg.Headers {
+		if string(h.Key) == key {
+			c.Msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.Msg.Headers = append(c.Msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c ProducerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.Msg.Headers))
+	for _, h := range c.Msg.Headers {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
+
+// StartConsume continues the producer's trace from the message headers.
+func StartConsume(ctx context.Context, msg *sarama.ConsumerMessage, group string) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, ConsumerCarrier(msg.Headers))
+	return Tracer().Start(ctx, msg.Topic+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingKafkaDestinationPartition(int(msg.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+			semconv.MessagingKafkaConsumerGroup(group),
+			attribute.String("messaging.kafka.message.key", string(msg.Key)),
+		),
+	)
+}
+
+// StartProduce starts a producer span and injects it into msg's headers.
+func StartProduce(ctx context.Context, msg *sarama.ProducerMessage) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(ctx, msg.Topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(msg.Topic),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, ProducerCarrier{Msg: msg})
+	return ctx, span
+}